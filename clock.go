@@ -0,0 +1,87 @@
+package newrelic
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of time for a Client's report cycles. Replace the system
+// clock with a ManualClock to drive cycles deterministically in tests.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// ManualClock is a Clock that only moves when Set or Advance is called
+type ManualClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []manualWaiter
+}
+
+type manualWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// NewManualClock creates a ManualClock set to now
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Now returns the clock's current time
+func (mc *ManualClock) Now() time.Time {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.now
+}
+
+// After returns a channel that receives the clock's time once it has been
+// moved at least d past the current time
+func (mc *ManualClock) After(d time.Duration) <-chan time.Time {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- mc.now
+		return ch
+	}
+	mc.waiters = append(mc.waiters, manualWaiter{deadline: mc.now.Add(d), ch: ch})
+	return ch
+}
+
+// Set moves the clock to t, firing any After channels that are due
+func (mc *ManualClock) Set(t time.Time) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	mc.now = t
+	pending := mc.waiters[:0]
+	for _, w := range mc.waiters {
+		if w.deadline.After(t) {
+			pending = append(pending, w)
+		} else {
+			w.ch <- t
+		}
+	}
+	mc.waiters = pending
+}
+
+// Advance moves the clock forward by d
+func (mc *ManualClock) Advance(d time.Duration) {
+	mc.Set(mc.Now().Add(d))
+}
+
+// Waiters returns the number of pending After channels. Tests can use it to
+// wait for a goroutine to block on the clock before advancing it.
+func (mc *ManualClock) Waiters() int {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return len(mc.waiters)
+}
@@ -0,0 +1,40 @@
+package newrelic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ManualClock(t *testing.T) {
+	t0 := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	mc := NewManualClock(t0)
+	assert.Equal(t, t0, mc.Now())
+
+	immediate := mc.After(0)
+	assert.Equal(t, t0, <-immediate)
+
+	soon := mc.After(10 * time.Second)
+	later := mc.After(time.Minute)
+	assert.Equal(t, 2, mc.Waiters())
+
+	mc.Advance(5 * time.Second)
+	assert.Equal(t, 0, len(soon))
+
+	mc.Advance(5 * time.Second)
+	assert.Equal(t, t0.Add(10*time.Second), <-soon)
+	assert.Equal(t, 1, mc.Waiters())
+
+	mc.Set(t0.Add(time.Hour))
+	assert.Equal(t, t0.Add(time.Hour), <-later)
+	assert.Equal(t, 0, mc.Waiters())
+	assert.Equal(t, t0.Add(time.Hour), mc.Now())
+}
+
+func Test_systemClock(t *testing.T) {
+	var c Clock = systemClock{}
+	before := time.Now()
+	assert.False(t, c.Now().Before(before))
+	assert.False(t, (<-c.After(time.Millisecond)).Before(before))
+}
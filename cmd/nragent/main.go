@@ -0,0 +1,83 @@
+/*
+Command nragent is a standalone agent for plugins that are not written in Go.
+It loads a config (see package config), then polls every configured metric
+and command each poll interval and reports them until it is interrupted:
+
+	nragent -config plugins.json
+
+Commands print metrics as JSON or "name[units] value" lines, as described in
+package command. Failed, timed out or oversized commands are logged with the
+rest of the cycle's errors. On SIGINT or SIGTERM a final report is sent before
+exiting.
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/neocortical/newrelic"
+	"github.com/neocortical/newrelic/config"
+)
+
+// shutdownTimeout limits how long the final report may take
+const shutdownTimeout = 10 * time.Second
+
+func main() {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	os.Exit(run(os.Args[1:], os.Stderr, stop))
+}
+
+func run(args []string, stderr io.Writer, stop <-chan os.Signal) int {
+	flags := flag.NewFlagSet("nragent", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "", "path to the JSON config `file`")
+	verbose := flags.Bool("v", false, "log every request")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *configPath == "" {
+		fmt.Fprintln(stderr, "nragent: -config is required")
+		flags.Usage()
+		return 2
+	}
+
+	newrelic.Logger = log.New(stderr, "nragent ", log.LstdFlags)
+	if *verbose {
+		newrelic.LogLevel = newrelic.LogDebug
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "nragent: %v\n", err)
+		return 1
+	}
+	client, err := cfg.Client()
+	if err != nil {
+		fmt.Fprintf(stderr, "nragent: invalid config: %v\n", err)
+		return 1
+	}
+	if client.License == "" {
+		fmt.Fprintf(stderr, "nragent: no license in the config or %s\n", config.LicenseEnv)
+		return 1
+	}
+
+	client.Run()
+	<-stop
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := client.ReportOnce(ctx); err != nil {
+		fmt.Fprintf(stderr, "nragent: final report: %v\n", err)
+		return 1
+	}
+	return 0
+}
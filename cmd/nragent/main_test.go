@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/neocortical/newrelic/newrelictest"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_run_reportsCommandMetrics(t *testing.T) {
+	collector := newrelictest.NewCollector()
+	defer collector.Close()
+
+	dir, err := ioutil.TempDir("", "nragent")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.json")
+	cfg := fmt.Sprintf(`{
+		"license": "abc123",
+		"url": %q,
+		"plugins": [{
+			"name": "Queue",
+			"guid": "com.example.queue",
+			"commands": [{"command": ["sh", "-c", "echo 'Queue/Depth[messages] 42'"]}]
+		}]
+	}`, collector.URL())
+	assert.Nil(t, ioutil.WriteFile(path, []byte(cfg), 0644))
+
+	stop := make(chan os.Signal, 1)
+	stop <- syscall.SIGTERM
+	stderr := &bytes.Buffer{}
+	assert.Equal(t, 0, run([]string{"-config", path}, stderr, stop))
+
+	assert.True(t, collector.AssertRequestCount(t, 1))
+	assert.True(t, collector.AssertMetricTotal(t, "Queue", "Queue/Depth[messages]", 42))
+}
+
+func Test_run_invalidConfig(t *testing.T) {
+	stderr := &bytes.Buffer{}
+	assert.Equal(t, 2, run(nil, stderr, nil))
+	assert.Equal(t, 1, run([]string{"-config", "/nonexistent"}, stderr, nil))
+}
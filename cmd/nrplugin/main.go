@@ -0,0 +1,107 @@
+/*
+Command nrplugin validates a plugin config and dry-runs its payload. It loads
+the config, runs one poll cycle of every configured metric, validates the
+resulting request and prints it as JSON:
+
+	nrplugin -config plugins.json
+	nrplugin -config plugins.json -post
+	nrplugin -config plugins.json -post -endpoint http://localhost:8080/metrics
+
+The request is only posted with -post, to -endpoint or else the config's url
+or the platform API. -dry-run never contacts New Relic, even with -post. The
+exit status is 1 if the config, a metric or the request is invalid, or if the
+post failed.
+*/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/neocortical/newrelic"
+	"github.com/neocortical/newrelic/config"
+)
+
+// defaultMaxBytes is the default limit on the encoded request size
+const defaultMaxBytes = 1 << 20
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("nrplugin", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "", "path to the JSON config `file`")
+	post := flags.Bool("post", false, "post the request after validating it")
+	endpoint := flags.String("endpoint", "", "post to `url` instead of the configured endpoint")
+	dryRun := flags.Bool("dry-run", false, "never contact New Relic, even with -post")
+	maxBytes := flags.Int("max-bytes", defaultMaxBytes, "largest encoded request accepted")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *configPath == "" {
+		fmt.Fprintln(stderr, "nrplugin: -config is required")
+		flags.Usage()
+		return 2
+	}
+
+	status := 0
+	fail := func(format string, args ...interface{}) {
+		fmt.Fprintf(stderr, "nrplugin: "+format+"\n", args...)
+		status = 1
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fail("%v", err)
+		return status
+	}
+	client, err := cfg.Client()
+	if err != nil {
+		fail("invalid config: %v", err)
+	}
+	if client == nil {
+		return status
+	}
+
+	request, err := client.GenerateRequest()
+	if err != nil {
+		fail("poll failed: %v", err)
+	}
+	if err := newrelic.ValidateRequest(request); err != nil {
+		fail("invalid request: %v", err)
+	}
+
+	out, err := json.MarshalIndent(request, "", "  ")
+	if err != nil {
+		fail("error encoding request: %v", err)
+		return status
+	}
+	if compact, _ := json.Marshal(request); len(compact) > *maxBytes {
+		fail("request is %d bytes, more than the %d allowed", len(compact), *maxBytes)
+	}
+	fmt.Fprintln(stdout, string(out))
+
+	if !*post {
+		return status
+	}
+	if *endpoint != "" {
+		client.URL = *endpoint
+	}
+	if *dryRun {
+		fmt.Fprintf(stderr, "nrplugin: dry run, not posting to %s\n", client.URL)
+		return status
+	}
+	if status != 0 {
+		fmt.Fprintln(stderr, "nrplugin: not posting an invalid request")
+		return status
+	}
+	if err := client.SendSnapshots(request.Plugins); err != nil {
+		fail("post failed: %v", err)
+	}
+	return status
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/neocortical/newrelic/model"
+	"github.com/neocortical/newrelic/newrelictest"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, name string) (path string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "nrplugin")
+	assert.Nil(t, err)
+
+	depth := filepath.Join(dir, "depth")
+	assert.Nil(t, ioutil.WriteFile(depth, []byte("7"), 0644))
+
+	path = filepath.Join(dir, "config.json")
+	cfg := fmt.Sprintf(`{
+		"license": "abc123",
+		"plugins": [{
+			"name": %q,
+			"guid": "com.example.queue",
+			"metrics": [{"name": "Depth", "units": "messages", "file": %q}]
+		}]
+	}`, name, depth)
+	assert.Nil(t, ioutil.WriteFile(path, []byte(cfg), 0644))
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func Test_run_printsRequest(t *testing.T) {
+	path, cleanup := writeConfig(t, "Queue")
+	defer cleanup()
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	assert.Equal(t, 0, run([]string{"-config", path}, stdout, stderr))
+	assert.Equal(t, "", stderr.String())
+
+	var request model.Request
+	assert.Nil(t, json.Unmarshal(stdout.Bytes(), &request))
+	assert.Equal(t, 7.0, request.Plugins[0].Metrics["Component/Depth[messages]"])
+}
+
+func Test_run_invalid(t *testing.T) {
+	path, cleanup := writeConfig(t, "")
+	defer cleanup()
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	assert.Equal(t, 1, run([]string{"-config", path, "-post", "-endpoint", "http://127.0.0.1:1"}, stdout, stderr))
+	assert.Contains(t, stderr.String(), "plugin name is empty")
+	assert.Contains(t, stderr.String(), "not posting")
+
+	assert.Equal(t, 2, run(nil, stdout, stderr))
+	assert.Equal(t, 1, run([]string{"-config", "/nonexistent"}, stdout, stderr))
+
+	path, cleanup = writeConfig(t, "Queue")
+	defer cleanup()
+	assert.Equal(t, 1, run([]string{"-config", path, "-max-bytes", "10"}, stdout, stderr))
+}
+
+func Test_run_post(t *testing.T) {
+	collector := newrelictest.NewCollector()
+	defer collector.Close()
+
+	path, cleanup := writeConfig(t, "Queue")
+	defer cleanup()
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	assert.Equal(t, 0, run([]string{"-config", path, "-post", "-dry-run", "-endpoint", collector.URL()}, stdout, stderr))
+	collector.AssertRequestCount(t, 0)
+	assert.Contains(t, stderr.String(), "dry run")
+
+	assert.Equal(t, 0, run([]string{"-config", path, "-post", "-endpoint", collector.URL()}, stdout, stderr))
+	collector.AssertRequestCount(t, 1)
+	collector.AssertMetricTotal(t, "Queue", "Depth[messages]", 7)
+}
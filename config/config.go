@@ -0,0 +1,399 @@
+/*
+Package config loads JSON definitions of a client and its plugins for the
+command line tools. A minimal config looks like:
+
+	{
+		"license": "abc123",
+		"poll_interval": "1m",
+		"plugins": [{
+			"name": "Queue",
+			"guid": "com.example.newrelic.queue",
+			"metrics": [
+				{"name": "Queue/Depth", "units": "messages", "file": "/var/run/queue/depth"},
+				{"name": "Queue/Processed", "units": "messages", "kind": "rate", "file": "/var/run/queue/processed"}
+			],
+			"commands": [
+				{"command": ["/usr/local/bin/queue-stats", "--all"], "timeout": "5s"}
+			],
+			"logs": [{
+				"file": "/var/log/queue.log",
+				"rules": [
+					{"name": "Errors", "units": "lines", "pattern": "ERROR"},
+					{"name": "Latency", "units": "ms", "pattern": "took=(\\d+)ms", "value": true}
+				]
+			}]
+		}]
+	}
+
+Commands are run on every poll and print any number of metrics, in the
+formats described in package command. Logs are tailed as described in package
+logtail.
+
+The license may be left out and taken from the NEWRELIC_LICENSE environment
+variable instead. In containers, "host_env" can name a variable holding the
+node name to report as the agent's host.
+*/
+package config
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neocortical/newrelic"
+	"github.com/neocortical/newrelic/plugins/command"
+	"github.com/neocortical/newrelic/plugins/logtail"
+)
+
+// LicenseEnv is the environment variable used when the config has no license
+const LicenseEnv = newrelic.LicenseEnv
+
+// Config defines a client and its plugins
+type Config struct {
+	License      string            `json:"license"`
+	PollInterval Duration          `json:"poll_interval"`
+	URL          string            `json:"url"`
+	MetricPrefix string            `json:"metric_prefix"`
+	Labels       map[string]string `json:"labels"`
+	Plugins      []PluginConfig    `json:"plugins"`
+
+	// Host overrides the agent's host name. HostEnv names an environment
+	// variable to take it from instead, falling back to the system host name.
+	Host    string `json:"host"`
+	HostEnv string `json:"host_env"`
+
+	// Version overrides the agent's version
+	Version string `json:"version"`
+
+	// TLS configures connections to New Relic or a relay
+	TLS TLSConfig `json:"tls"`
+}
+
+// TLSConfig configures the client's connections. The client gets its own
+// transport when any of it is set.
+type TLSConfig struct {
+	// CABundle is a PEM file of CAs trusted in addition to the system's
+	CABundle string `json:"ca_bundle"`
+
+	// ClientCert and ClientKey are PEM files presented for mutual TLS
+	ClientCert string `json:"client_cert"`
+	ClientKey  string `json:"client_key"`
+
+	// MinVersion is the lowest TLS version allowed, e.g. "1.2"
+	MinVersion string `json:"min_version"`
+
+	// ProxyFromEnv sends requests through the proxy named by HTTPS_PROXY etc.
+	ProxyFromEnv bool `json:"proxy_from_env"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// PluginConfig defines a plugin and the sources of its metrics
+type PluginConfig struct {
+	Name         string            `json:"name"`
+	GUID         string            `json:"guid"`
+	MetricPrefix string            `json:"metric_prefix"`
+	Labels       map[string]string `json:"labels"`
+	Metrics      []MetricConfig    `json:"metrics"`
+	Commands     []CommandConfig   `json:"commands"`
+	Logs         []LogConfig       `json:"logs"`
+}
+
+// MetricConfig defines a metric read from a file holding a single number
+type MetricConfig struct {
+	Name  string `json:"name"`
+	Units string `json:"units"`
+
+	// Kind is newrelic.KindGauge (the default), KindDelta or KindRate
+	Kind string `json:"kind"`
+
+	File string `json:"file"`
+}
+
+// CommandConfig defines an external command whose output is polled for metrics
+type CommandConfig struct {
+	// Command is the program and its arguments
+	Command []string `json:"command"`
+	Dir     string   `json:"dir"`
+	Env     []string `json:"env"`
+
+	Timeout   Duration `json:"timeout"`
+	MaxOutput int      `json:"max_output"`
+
+	// Kind is the default kind of the command's metrics
+	Kind string `json:"kind"`
+}
+
+// LogConfig defines a log file tailed for metrics
+type LogConfig struct {
+	File        string          `json:"file"`
+	Prefix      string          `json:"prefix"`
+	MaxLineSize int             `json:"max_line_size"`
+	Rules       []LogRuleConfig `json:"rules"`
+}
+
+// LogRuleConfig defines a rule applied to every line of a log
+type LogRuleConfig struct {
+	Name    string `json:"name"`
+	Units   string `json:"units"`
+	Pattern string `json:"pattern"`
+
+	// Value records the number in the pattern's first capture group rather
+	// than counting matching lines
+	Value bool `json:"value"`
+}
+
+// Duration is a time.Duration written as a string such as "30s" or "1m"
+type Duration time.Duration
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"1m\": %v", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Load reads and parses a config file
+func Load(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Parse parses a JSON config. Unknown fields are rejected to catch typos.
+func Parse(b []byte) (*Config, error) {
+	cfg := &Config{}
+	decoder := json.NewDecoder(strings.NewReader(string(b)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("error parsing config: %v", err)
+	}
+
+	if cfg.License == "" {
+		cfg.License = os.Getenv(LicenseEnv)
+	}
+	if cfg.PollInterval < 0 {
+		return nil, fmt.Errorf("poll_interval must not be negative")
+	}
+	return cfg, nil
+}
+
+// Client creates a client with every configured plugin and metric. All
+// invalid plugins and metrics are reported together.
+func (cfg *Config) Client() (*newrelic.Client, error) {
+	var opts []newrelic.Option
+	if cfg.HostEnv != "" {
+		opts = append(opts, newrelic.WithHostFromEnv(cfg.HostEnv))
+	}
+	if cfg.Host != "" {
+		opts = append(opts, newrelic.WithHost(cfg.Host))
+	}
+	if cfg.Version != "" {
+		opts = append(opts, newrelic.WithVersion(cfg.Version))
+	}
+	tlsOpts, cerr := cfg.TLS.options()
+	if cerr != nil {
+		return nil, cerr
+	}
+	client, cerr := newrelic.NewClient(cfg.License, append(opts, tlsOpts...)...)
+	if cerr != nil {
+		return nil, cerr
+	}
+	if cfg.PollInterval > 0 {
+		client.PollInterval = time.Duration(cfg.PollInterval)
+	}
+	if cfg.URL != "" {
+		client.URL = cfg.URL
+	}
+	client.MetricPrefix = cfg.MetricPrefix
+	client.Labels = cfg.Labels
+
+	var err newrelic.CompositeError
+	for _, pc := range cfg.Plugins {
+		p, perr := pc.Plugin()
+		if ce, ok := perr.(newrelic.CompositeError); ok {
+			err = append(err, ce...)
+		}
+		err = err.Accumulate(client.AddPlugin(p))
+	}
+
+	if err != nil {
+		return client, err
+	}
+	return client, nil
+}
+
+// options returns the client options for the TLS config
+func (tc TLSConfig) options() (opts []newrelic.Option, err error) {
+	if tc.CABundle != "" {
+		opts = append(opts, newrelic.WithCABundle(tc.CABundle))
+	}
+	if tc.ClientCert != "" || tc.ClientKey != "" {
+		if tc.ClientCert == "" || tc.ClientKey == "" {
+			return nil, fmt.Errorf("tls client_cert and client_key must be set together")
+		}
+		opts = append(opts, newrelic.WithClientCertificate(tc.ClientCert, tc.ClientKey))
+	}
+	if tc.MinVersion != "" {
+		version, ok := tlsVersions[tc.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown tls min_version %q", tc.MinVersion)
+		}
+		opts = append(opts, newrelic.WithMinTLSVersion(version))
+	}
+	if tc.ProxyFromEnv {
+		opts = append(opts, newrelic.WithProxyFromEnvironment())
+	}
+	return opts, nil
+}
+
+// Plugin creates the configured plugin. Invalid metrics are left out and
+// reported in the error.
+func (pc PluginConfig) Plugin() (*newrelic.Plugin, error) {
+	p := &newrelic.Plugin{
+		Name:         pc.Name,
+		GUID:         pc.GUID,
+		MetricPrefix: pc.MetricPrefix,
+		Labels:       pc.Labels,
+	}
+
+	var err newrelic.CompositeError
+	for _, mc := range pc.Metrics {
+		m, merr := mc.Metric()
+		if merr == nil {
+			merr = p.AddMetric(m)
+		}
+		if merr != nil {
+			err = err.Accumulate(fmt.Errorf("plugin %s: %v", pc.Name, merr))
+		}
+	}
+
+	for _, cc := range pc.Commands {
+		src, cerr := cc.Source()
+		if cerr != nil {
+			err = err.Accumulate(fmt.Errorf("plugin %s: %v", pc.Name, cerr))
+			continue
+		}
+		p.AddSource(src)
+	}
+
+	for _, lc := range pc.Logs {
+		src, lerr := lc.Source()
+		if lerr != nil {
+			err = err.Accumulate(fmt.Errorf("plugin %s: %v", pc.Name, lerr))
+			continue
+		}
+		p.AddSource(src)
+	}
+
+	if err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+// Metric creates the configured metric
+func (mc MetricConfig) Metric() (newrelic.Metric, error) {
+	if mc.File == "" {
+		return nil, fmt.Errorf("metric %s has no file", mc.Name)
+	}
+	return newMetric(mc.Name, mc.Units, mc.Kind, readFile(mc.File))
+}
+
+// Source creates the configured command source
+func (cc CommandConfig) Source() (*command.Source, error) {
+	if len(cc.Command) == 0 || cc.Command[0] == "" {
+		return nil, fmt.Errorf("command is empty")
+	}
+	switch cc.Kind {
+	case "", newrelic.KindGauge, newrelic.KindDelta, newrelic.KindRate:
+	default:
+		return nil, fmt.Errorf("command %s has unknown kind %q", cc.Command[0], cc.Kind)
+	}
+
+	src := command.New(cc.Command[0], cc.Command[1:]...)
+	src.Dir = cc.Dir
+	src.Env = cc.Env
+	src.Timeout = time.Duration(cc.Timeout)
+	src.MaxOutput = cc.MaxOutput
+	src.Kind = cc.Kind
+	return src, nil
+}
+
+// Source creates the configured log source
+func (lc LogConfig) Source() (*logtail.Source, error) {
+	if lc.File == "" {
+		return nil, fmt.Errorf("log has no file")
+	}
+	if len(lc.Rules) == 0 {
+		return nil, fmt.Errorf("log %s has no rules", lc.File)
+	}
+
+	src := logtail.New(lc.File)
+	if lc.Prefix != "" {
+		src.Prefix = lc.Prefix
+	}
+	src.MaxLineSize = lc.MaxLineSize
+	for _, rc := range lc.Rules {
+		if rc.Name == "" {
+			return nil, fmt.Errorf("log %s has a rule with no name", lc.File)
+		}
+		pattern, err := regexp.Compile(rc.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("log %s rule %s: %v", lc.File, rc.Name, err)
+		}
+		if rc.Value && pattern.NumSubexp() == 0 {
+			return nil, fmt.Errorf("log %s rule %s has no capture group for its value", lc.File, rc.Name)
+		}
+		src.Rules = append(src.Rules, logtail.Rule{Name: rc.Name, Units: rc.Units, Pattern: pattern, Value: rc.Value})
+	}
+	return src, nil
+}
+
+// newMetric creates a metric of the given kind
+func newMetric(name, units, kind string, pollFn func() (float64, error)) (newrelic.Metric, error) {
+	switch kind {
+	case "", newrelic.KindGauge:
+		return newrelic.NewMetric(name, units, pollFn), nil
+	case newrelic.KindDelta:
+		return newrelic.NewDeltaMetric(name, units, pollFn), nil
+	case newrelic.KindRate:
+		return newrelic.NewRateMetric(name, units, pollFn), nil
+	}
+	return nil, fmt.Errorf("metric %s has unknown kind %q", name, kind)
+}
+
+func readFile(path string) func() (float64, error) {
+	return func() (float64, error) {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return 0, err
+		}
+		return strconv.ParseFloat(strings.TrimSpace(string(b)), 64)
+	}
+}
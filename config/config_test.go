@@ -0,0 +1,176 @@
+package config
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func Test_Parse(t *testing.T) {
+	os.Setenv(LicenseEnv, "fromenv")
+	defer os.Unsetenv(LicenseEnv)
+
+	cfg, err := Parse([]byte(`{"poll_interval": "30s", "plugins": [{"name": "Queue", "guid": "com.example.queue"}]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "fromenv", cfg.License)
+	assert.Equal(t, Duration(30*time.Second), cfg.PollInterval)
+	assert.Equal(t, "Queue", cfg.Plugins[0].Name)
+
+	_, err = Parse([]byte(`{"poll_interval": 30}`))
+	assert.NotNil(t, err)
+	_, err = Parse([]byte(`{"poll_interval": "-1m"}`))
+	assert.NotNil(t, err)
+	_, err = Parse([]byte(`{"plugins": [{"nmae": "Queue"}]}`))
+	assert.NotNil(t, err)
+}
+
+func Test_Config_Client(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	depth := writeFile(t, dir, "depth", "42\n")
+
+	cfg := &Config{
+		License:      "abc123",
+		PollInterval: Duration(time.Minute),
+		URL:          "http://localhost/metrics",
+		Plugins: []PluginConfig{{
+			Name: "Queue",
+			GUID: "com.example.queue",
+			Metrics: []MetricConfig{
+				{Name: "Depth", Units: "messages", File: depth},
+				{Name: "Processed", Units: "messages", Kind: "delta", File: depth},
+			},
+		}},
+	}
+	client, err := cfg.Client()
+	assert.Nil(t, err)
+	assert.Equal(t, "http://localhost/metrics", client.URL)
+
+	request, err := client.GenerateRequest()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"Component/Depth[messages]": 42.0}, request.Plugins[0].Metrics)
+}
+
+func Test_Config_Client_commands(t *testing.T) {
+	cfg, err := Parse([]byte(`{"plugins": [{
+		"name": "Queue",
+		"guid": "com.example.queue",
+		"commands": [{"command": ["echo", "Depth[messages] 3"], "timeout": "5s"}]
+	}]}`))
+	assert.Nil(t, err)
+	client, err := cfg.Client()
+	assert.Nil(t, err)
+
+	request, err := client.GenerateRequest()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"Component/Depth[messages]": 3.0}, request.Plugins[0].Metrics)
+}
+
+func Test_Config_Client_invalid(t *testing.T) {
+	cfg := &Config{
+		Plugins: []PluginConfig{
+			{
+				Name: "Queue",
+				GUID: "com.example.queue",
+				Metrics: []MetricConfig{
+					{Name: "Depth", Units: "messages"},
+					{Name: "Depth", Units: "messages", Kind: "average", File: "depth"},
+					{Name: "Depth[1]", Units: "messages", File: "depth"},
+				},
+			},
+			{Name: "Bad", GUID: "bad"},
+			{
+				Name: "Commands",
+				GUID: "com.example.commands",
+				Commands: []CommandConfig{
+					{},
+					{Command: []string{"queue-stats"}, Kind: "average"},
+				},
+			},
+		},
+	}
+	_, err := cfg.Client()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "6 errors")
+}
+
+func Test_Config_Client_logs(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "queue.log", "ERROR before\n")
+
+	cfg, err := Parse([]byte(`{"plugins": [{
+		"name": "Queue",
+		"guid": "com.example.queue",
+		"logs": [{"file": "` + path + `", "rules": [{"name": "Errors", "units": "lines", "pattern": "ERROR"}]}]
+	}]}`))
+	assert.Nil(t, err)
+	client, err := cfg.Client()
+	assert.Nil(t, err)
+
+	request, err := client.GenerateRequest()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"Component/Log/Errors[lines]": 0.0}, request.Plugins[0].Metrics)
+}
+
+func Test_LogConfig_Source_invalid(t *testing.T) {
+	for _, lc := range []LogConfig{
+		{Rules: []LogRuleConfig{{Name: "Errors", Pattern: "ERROR"}}},
+		{File: "queue.log"},
+		{File: "queue.log", Rules: []LogRuleConfig{{Pattern: "ERROR"}}},
+		{File: "queue.log", Rules: []LogRuleConfig{{Name: "Errors", Pattern: "("}}},
+		{File: "queue.log", Rules: []LogRuleConfig{{Name: "Latency", Pattern: `took=\d+`, Value: true}}},
+	} {
+		_, err := lc.Source()
+		assert.NotNil(t, err)
+	}
+}
+
+func Test_Config_Client_agent(t *testing.T) {
+	os.Setenv("TEST_NODE_NAME", "node-1")
+	defer os.Unsetenv("TEST_NODE_NAME")
+
+	cfg, err := Parse([]byte(`{"host_env": "TEST_NODE_NAME", "version": "2.0.0"}`))
+	assert.Nil(t, err)
+	client, err := cfg.Client()
+	assert.Nil(t, err)
+	assert.Equal(t, "node-1", client.Agent().Host)
+	assert.Equal(t, "2.0.0", client.Agent().Version)
+
+	cfg.Host = "override"
+	client, err = cfg.Client()
+	assert.Nil(t, err)
+	assert.Equal(t, "override", client.Agent().Host)
+}
+
+func Test_Config_Client_tls(t *testing.T) {
+	cfg, err := Parse([]byte(`{"tls": {"min_version": "1.2", "proxy_from_env": true}}`))
+	assert.Nil(t, err)
+	client, err := cfg.Client()
+	assert.Nil(t, err)
+	transport := client.HTTPClient.Transport.(*http.Transport)
+	assert.Equal(t, uint16(tls.VersionTLS12), transport.TLSClientConfig.MinVersion)
+	assert.NotNil(t, transport.Proxy)
+
+	for _, tc := range []TLSConfig{
+		{MinVersion: "2.0"},
+		{ClientCert: "client.pem"},
+		{CABundle: filepath.Join(t.TempDir(), "missing.pem")},
+	} {
+		cfg := &Config{TLS: tc}
+		_, err := cfg.Client()
+		assert.NotNil(t, err)
+	}
+}
@@ -0,0 +1,103 @@
+package newrelic
+
+import (
+	"sync"
+	"time"
+
+	"github.com/neocortical/newrelic/model"
+)
+
+// NewDeltaMetric creates a metric from a cumulative value, such as a total
+// request count, that reports how much the value grew since the last poll.
+// Nothing is reported on the first poll. If the value decreases it is assumed
+// to have been reset and the new value is reported as the delta.
+func NewDeltaMetric(name, units string, pollFn func() (float64, error)) Metric {
+	return &deltaMetric{name: name, units: units, poll: pollFn}
+}
+
+// NewRateMetric creates a metric from a cumulative value that reports its
+// per-second rate of change since the last poll. Counter resets and the first
+// poll are handled as in NewDeltaMetric. Time is measured with the Clock of
+// the client reporting the metric.
+func NewRateMetric(name, units string, pollFn func() (float64, error)) Metric {
+	return &deltaMetric{name: name, units: units, poll: pollFn, rate: true}
+}
+
+// clocked is implemented by metrics that read the time when polled, so that
+// they can follow the client's Clock
+type clocked interface {
+	setClock(clock Clock)
+}
+
+// setClock passes clock on to m if it reads the time
+func setClock(m Metric, clock Clock) {
+	if c, ok := m.(clocked); ok && clock != nil {
+		c.setClock(clock)
+	}
+}
+
+type deltaMetric struct {
+	name  string
+	units string
+	poll  func() (float64, error)
+	rate  bool
+
+	mu       sync.Mutex
+	clock    Clock
+	primed   bool
+	last     float64
+	lastTime time.Time
+}
+
+func (dm *deltaMetric) setClock(clock Clock) {
+	dm.mu.Lock()
+	dm.clock = clock
+	dm.mu.Unlock()
+}
+
+func (dm *deltaMetric) Name() string  { return dm.name }
+func (dm *deltaMetric) Units() string { return dm.units }
+
+func (dm *deltaMetric) Poll() (float64, error) {
+	state, err := dm.PollAggregate()
+	return state.Total, err
+}
+
+// PollAggregate returns the delta or rate as a single sample, or no samples
+// if there is no previous value to compare against
+func (dm *deltaMetric) PollAggregate() (result model.MetricValue, err error) {
+	val, err := dm.poll()
+	if err != nil {
+		return result, err
+	}
+
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	var now time.Time
+	if dm.rate {
+		if dm.clock == nil {
+			dm.clock = systemClock{}
+		}
+		now = dm.clock.Now()
+	}
+	primed, last, lastTime := dm.primed, dm.last, dm.lastTime
+	dm.primed, dm.last, dm.lastTime = true, val, now
+	if !primed {
+		return result, nil
+	}
+
+	delta := val - last
+	if delta < 0 {
+		delta = val
+	}
+	if dm.rate {
+		elapsed := now.Sub(lastTime).Seconds()
+		if elapsed <= 0 {
+			return result, nil
+		}
+		delta /= elapsed
+	}
+
+	return updateState(result, delta), nil
+}
@@ -0,0 +1,91 @@
+package newrelic
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/neocortical/newrelic/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewDeltaMetric(t *testing.T) {
+	total := 10.0
+	m := NewDeltaMetric("Requests", "requests", func() (float64, error) { return total, nil })
+	assert.Equal(t, "Requests", m.Name())
+	assert.Equal(t, "requests", m.Units())
+
+	sm := &statefulMetric{metric: m}
+
+	// no baseline yet
+	result, err := sm.generateMetricSnapshot()
+	assert.Nil(t, err)
+	assert.Nil(t, result)
+
+	total = 25
+	result, err = sm.generateMetricSnapshot()
+	assert.Nil(t, err)
+	assert.Equal(t, 15.0, result)
+	sm.clearState()
+
+	// reset
+	total = 4
+	result, err = sm.generateMetricSnapshot()
+	assert.Nil(t, err)
+	assert.Equal(t, 4.0, result)
+
+	total = 6
+	val, err := m.Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, 2.0, val)
+}
+
+func Test_NewDeltaMetric_error(t *testing.T) {
+	m := NewDeltaMetric("Requests", "requests", func() (float64, error) { return 0, errors.New("derp") })
+	_, err := m.Poll()
+	assert.NotNil(t, err)
+}
+
+func Test_NewRateMetric(t *testing.T) {
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	total := 100.0
+	m := NewRateMetric("Requests", "requests/second", func() (float64, error) { return total, nil })
+	mc := NewManualClock(now)
+	setClock(m, mc)
+
+	val, err := m.(AggregateMetric).PollAggregate()
+	assert.Nil(t, err)
+	assert.Equal(t, model.MetricValue{}, val)
+
+	mc.Advance(10 * time.Second)
+	total = 150
+	rate, err := m.Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, 5.0, rate)
+
+	// no time elapsed, no rate
+	val, err = m.(AggregateMetric).PollAggregate()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, val.Count)
+}
+
+func Test_NewRateMetric_clientClock(t *testing.T) {
+	mc := NewManualClock(time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC))
+	total := 100.0
+	pollFn := func() (float64, error) { return total, nil }
+
+	p := &Plugin{Name: "foo", GUID: "com.example.foo"}
+	assert.Nil(t, p.AddMetric(NewRateMetric("Requests", "requests/second", pollFn)))
+	assert.Nil(t, p.AddMetric(Clamp(NewRateMetric("Clamped", "requests/second", pollFn), 0, 2)))
+
+	snapshot, err := p.snapshot(time.Minute, naming{clock: mc})
+	assert.Nil(t, err)
+	p.clearState()
+
+	mc.Advance(20 * time.Second)
+	total = 200
+	snapshot, err = p.snapshot(time.Minute, naming{clock: mc})
+	assert.Nil(t, err)
+	assert.Equal(t, 5.0, snapshot.Metrics["Component/Requests[requests/second]"])
+	assert.Equal(t, 2.0, snapshot.Metrics["Component/Clamped[requests/second]"])
+}
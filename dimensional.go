@@ -0,0 +1,124 @@
+package newrelic
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/neocortical/newrelic/model"
+)
+
+// MetricAPIEndpoint is the dimensional Metric API endpoint. Set
+// Client.MetricAPIURL to it to report every cycle there as well.
+const MetricAPIEndpoint = "https://metric-api.newrelic.com/metric/v1"
+
+// dimensionalSample is a metric's samples not yet delivered to the Metric API
+// and the type they are reported as
+type dimensionalSample struct {
+	value model.MetricValue
+	typ   string
+}
+
+// dimensionalType returns the Metric API type of a metric. It depends only on
+// the kind of metric, so that a metric keeps its type however many samples a
+// cycle has: counts of events during the cycle are counts, metrics that
+// collect many samples are summaries, and measurements of a level are gauges.
+func dimensionalType(m Metric) string {
+	switch mm := m.(type) {
+	case *Counter:
+		return model.MetricTypeCount
+	case *sourceMetric:
+		if mm.count {
+			return model.MetricTypeCount
+		}
+		if mm.aggregate {
+			return model.MetricTypeSummary
+		}
+		return model.MetricTypeGauge
+	case *deltaMetric:
+		if mm.rate {
+			return model.MetricTypeGauge
+		}
+		return model.MetricTypeCount
+	case *filteredMetric:
+		return dimensionalType(mm.metric)
+	case *mergedMetric:
+		if dimensionalType(mm.metrics[0]) == model.MetricTypeCount {
+			return model.MetricTypeCount
+		}
+		return model.MetricTypeSummary
+	case AggregateMetric:
+		return model.MetricTypeSummary
+	}
+	return model.MetricTypeGauge
+}
+
+// generateMetricAPIRequest builds one Metric API batch per component from the
+// samples not yet delivered there. The component name, GUID and host become
+// attributes, and each batch covers the time since the component's last
+// delivery, ending at t.
+func (c *Client) generateMetricAPIRequest(t time.Time) model.MetricAPIRequest {
+	result := model.MetricAPIRequest{}
+
+	for _, p := range c.plugins() {
+		p.mu.Lock()
+		interval := p.dimDuration
+		batch := model.MetricBatch{
+			Common: model.MetricCommon{
+				Timestamp:  t.Add(-interval).UnixNano() / int64(time.Millisecond),
+				IntervalMs: int64(interval / time.Millisecond),
+				Attributes: map[string]interface{}{
+					"component": p.Name,
+					"guid":      p.GUID,
+					"host":      c.agent.Host,
+				},
+			},
+			Metrics: []model.DimensionalMetric{},
+		}
+
+		for key, sample := range p.dimensional {
+			name, units := splitMetricKey(key)
+			batch.Metrics = append(batch.Metrics, model.DimensionalMetric{
+				Name:       name,
+				Type:       sample.typ,
+				Value:      dimensionalValue(sample),
+				Attributes: map[string]interface{}{"unit": units},
+			})
+		}
+		p.mu.Unlock()
+		sort.Slice(batch.Metrics, func(a, b int) bool {
+			return batch.Metrics[a].Name < batch.Metrics[b].Name
+		})
+
+		result = append(result, batch)
+	}
+
+	return result
+}
+
+// splitMetricKey turns a Component/Name[units] key into the name and units
+func splitMetricKey(key string) (name, units string) {
+	name = strings.TrimPrefix(key, "Component/")
+	if i := strings.LastIndex(name, "["); i >= 0 && strings.HasSuffix(name, "]") {
+		return name[:i], name[i+1 : len(name)-1]
+	}
+	return name, ""
+}
+
+// dimensionalValue returns the value of a sample for its type. A gauge with
+// several samples, left by failed deliveries, is reported as their mean.
+func dimensionalValue(sample dimensionalSample) interface{} {
+	v := sample.value
+	switch sample.typ {
+	case model.MetricTypeCount:
+		return v.Total
+	case model.MetricTypeSummary:
+		return model.SummaryValue{
+			Count: float64(v.Count),
+			Sum:   v.Total,
+			Min:   v.Min,
+			Max:   v.Max,
+		}
+	}
+	return v.Total / float64(v.Count)
+}
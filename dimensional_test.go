@@ -0,0 +1,159 @@
+package newrelic
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/neocortical/newrelic/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_splitMetricKey(t *testing.T) {
+	name, units := splitMetricKey("Component/Queue/Depth[messages]")
+	assert.Equal(t, "Queue/Depth", name)
+	assert.Equal(t, "messages", units)
+
+	name, units = splitMetricKey("Component/Depth")
+	assert.Equal(t, "Depth", name)
+	assert.Equal(t, "", units)
+}
+
+func Test_generateMetricAPIRequest(t *testing.T) {
+	p := &Plugin{Name: "MyPlugin", GUID: "com.example.myplugin"}
+	counter := NewCounter("Requests", "requests")
+	recorder := NewRecorder("Latency", "ms")
+	p.AddMetric(NewMetric("Depth", "messages", func() (float64, error) { return 3, nil }))
+	p.AddMetric(counter)
+	p.AddMetric(recorder)
+	p.AddMetric(Clamp(NewDeltaMetric("Bytes", "bytes", func() (float64, error) { return 10, nil }), 0, 100))
+
+	c := &Client{
+		PollInterval: time.Minute,
+		Plugins:      []*Plugin{p},
+		agent:        model.Agent{Host: "10.0.0.1"},
+	}
+
+	counter.Add(5)
+	recorder.Record(1)
+	recorder.Record(3)
+	now := time.Unix(1000, 0)
+	_, err := c.generateRequest(now)
+	assert.Nil(t, err)
+
+	apiRequest := c.generateMetricAPIRequest(now)
+	assert.Equal(t, 1, len(apiRequest))
+	batch := apiRequest[0]
+	assert.Equal(t, int64(940000), batch.Common.Timestamp)
+	assert.Equal(t, int64(60000), batch.Common.IntervalMs)
+	assert.Equal(t, map[string]interface{}{
+		"component": "MyPlugin",
+		"guid":      "com.example.myplugin",
+		"host":      "10.0.0.1",
+	}, batch.Common.Attributes)
+
+	// the delta has no sample until its second poll
+	assert.Equal(t, []model.DimensionalMetric{
+		{Name: "Depth", Type: model.MetricTypeGauge, Value: 3.0, Attributes: map[string]interface{}{"unit": "messages"}},
+		{Name: "Latency", Type: model.MetricTypeSummary, Value: model.SummaryValue{Count: 2, Sum: 4, Min: 1, Max: 3}, Attributes: map[string]interface{}{"unit": "ms"}},
+		{Name: "Requests", Type: model.MetricTypeCount, Value: 5.0, Attributes: map[string]interface{}{"unit": "requests"}},
+	}, batch.Metrics)
+
+	// a recorder with a single sample is still a summary
+	c.clearDimensionalState()
+	recorder.Record(2)
+	_, err = c.generateRequest(now)
+	assert.Nil(t, err)
+	apiRequest = c.generateMetricAPIRequest(now)
+	assert.Equal(t, model.DimensionalMetric{
+		Name: "Latency", Type: model.MetricTypeSummary, Value: model.SummaryValue{Count: 1, Sum: 2, Min: 2, Max: 2}, Attributes: map[string]interface{}{"unit": "ms"},
+	}, apiRequest[0].Metrics[2])
+}
+
+func Test_dimensionalType(t *testing.T) {
+	count := NewCounter("Requests", "requests")
+	gauge := NewMetric("Depth", "messages", func() (float64, error) { return 3, nil })
+	recorder := NewRecorder("Latency", "ms")
+
+	assert.Equal(t, model.MetricTypeCount, dimensionalType(count))
+	assert.Equal(t, model.MetricTypeGauge, dimensionalType(gauge))
+	assert.Equal(t, model.MetricTypeSummary, dimensionalType(recorder))
+	assert.Equal(t, model.MetricTypeCount, dimensionalType(NewDeltaMetric("Bytes", "bytes", nil)))
+	assert.Equal(t, model.MetricTypeGauge, dimensionalType(NewRateMetric("Bytes", "bytes/second", nil)))
+	assert.Equal(t, model.MetricTypeCount, dimensionalType(Clamp(count, 0, 1)))
+	assert.Equal(t, model.MetricTypeSummary, dimensionalType(Clamp(recorder, 0, 1)))
+	assert.Equal(t, model.MetricTypeSummary, dimensionalType(mergeMetrics(gauge, gauge)))
+}
+
+func Test_ReportOnce_metricAPI(t *testing.T) {
+	pluginStatus := http.StatusOK
+	metricStatus := http.StatusAccepted
+	var pluginRequests []model.Request
+	var metricAPIRequests []model.MetricAPIRequest
+	pluginSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var req model.Request
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+		pluginRequests = append(pluginRequests, req)
+		rw.WriteHeader(pluginStatus)
+	}))
+	defer pluginSvr.Close()
+	metricSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var req model.MetricAPIRequest
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+		metricAPIRequests = append(metricAPIRequests, req)
+		rw.WriteHeader(metricStatus)
+	}))
+	defer metricSvr.Close()
+
+	counter := NewCounter("Requests", "requests")
+	p := &Plugin{Name: "MyPlugin", GUID: "com.example.myplugin"}
+	p.AddMetric(counter)
+
+	c := New("abc123")
+	c.URL = pluginSvr.URL
+	c.MetricAPIURL = metricSvr.URL
+	c.AddPlugin(p)
+
+	counter.Add(2)
+	assert.Nil(t, c.ReportOnce(context.Background()))
+	assert.Equal(t, 1, len(metricAPIRequests))
+	assert.Equal(t, "Requests", metricAPIRequests[0][0].Metrics[0].Name)
+	assert.Equal(t, 2.0, metricAPIRequests[0][0].Metrics[0].Value)
+
+	// the plugin API failing keeps its state for the next report, but the
+	// Metric API, which accepted the samples, doesn't receive them again
+	pluginStatus = http.StatusServiceUnavailable
+	counter.Add(3)
+	assert.NotNil(t, c.ReportOnce(context.Background()))
+	counter.Add(4)
+	pluginStatus = http.StatusOK
+	assert.Nil(t, c.ReportOnce(context.Background()))
+	assert.Equal(t, 3, len(metricAPIRequests))
+	assert.Equal(t, 3.0, metricAPIRequests[1][0].Metrics[0].Value)
+	assert.Equal(t, 4.0, metricAPIRequests[2][0].Metrics[0].Value)
+	assert.Equal(t, time.Duration(0), c.Plugins[0].duration)
+
+	// and the other way around
+	metricStatus = http.StatusServiceUnavailable
+	counter.Add(5)
+	assert.NotNil(t, c.ReportOnce(context.Background()))
+	metricStatus = http.StatusAccepted
+	counter.Add(6)
+	assert.Nil(t, c.ReportOnce(context.Background()))
+	assert.Equal(t, 5, len(pluginRequests))
+	assert.Equal(t, 6.0, pluginRequests[4].Plugins[0].Metrics["Component/Requests[requests]"])
+	assert.Equal(t, 11.0, metricAPIRequests[4][0].Metrics[0].Value)
+	assert.Equal(t, 5, len(metricAPIRequests))
+
+	// with only the Metric API configured, its acceptance clears state
+	c.URL = ""
+	counter.Add(1)
+	assert.Nil(t, c.ReportOnce(context.Background()))
+	counter.Add(1)
+	assert.Nil(t, c.ReportOnce(context.Background()))
+	assert.Equal(t, 7, len(metricAPIRequests))
+	assert.Equal(t, 1.0, metricAPIRequests[6][0].Metrics[0].Value)
+}
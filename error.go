@@ -38,3 +38,18 @@ func (ce CompositeError) Error() string {
 	fmt.Fprint(buf, "]")
 	return buf.String()
 }
+
+// ResponseError is returned when the platform API responds with anything
+// other than 200 OK
+type ResponseError struct {
+	StatusCode int
+	Body       string
+}
+
+// Error implements the error interface.
+func (re *ResponseError) Error() string {
+	if re.Body == "" {
+		return fmt.Sprintf("newrelic encountered %d response", re.StatusCode)
+	}
+	return fmt.Sprintf("newrelic encountered %d response: %s", re.StatusCode, re.Body)
+}
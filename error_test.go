@@ -36,3 +36,11 @@ func Test_Accumulate(t *testing.T) {
 	ce = CompositeError{}
 	assert.Equal(t, "", ce.Error())
 }
+
+func Test_ResponseError(t *testing.T) {
+	err := &ResponseError{StatusCode: 403}
+	assert.Equal(t, "newrelic encountered 403 response", err.Error())
+
+	err.Body = "invalid license key"
+	assert.Equal(t, "newrelic encountered 403 response: invalid license key", err.Error())
+}
@@ -0,0 +1,122 @@
+package newrelic
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"github.com/neocortical/newrelic/model"
+)
+
+const (
+	// DefaultMaxEvents is the default limit on buffered events
+	DefaultMaxEvents = 10000
+
+	// maxEventBatchSize is the most events sent in a single post
+	maxEventBatchSize = 1000
+)
+
+// eventTypePattern matches the event types accepted by Insights
+var eventTypePattern = regexp.MustCompile(`^[A-Za-z0-9_:]{1,255}$`)
+
+// EventsEndpoint returns the Insights insert endpoint for an account
+func EventsEndpoint(accountID string) string {
+	return fmt.Sprintf("https://insights-collector.newrelic.com/v1/accounts/%s/events", accountID)
+}
+
+// RecordEvent buffers a custom event until the next report cycle. Attribute
+// values must be strings, finite numbers or booleans, and eventType and
+// timestamp are reserved. Events are timestamped with the client's clock.
+func (c *Client) RecordEvent(eventType string, attributes map[string]interface{}) error {
+	if !eventTypePattern.MatchString(eventType) {
+		return fmt.Errorf("invalid event type %q", eventType)
+	}
+
+	event := model.Event{}
+	for k, v := range attributes {
+		if k == "eventType" || k == "timestamp" {
+			return fmt.Errorf("event %s attribute %s is reserved", eventType, k)
+		}
+		switch f := v.(type) {
+		case float64:
+			if math.IsNaN(f) || math.IsInf(f, 0) {
+				return fmt.Errorf("event %s attribute %s has non-finite value %v", eventType, k, f)
+			}
+		case float32:
+			if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+				return fmt.Errorf("event %s attribute %s has non-finite value %v", eventType, k, f)
+			}
+		case string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		default:
+			return fmt.Errorf("event %s attribute %s has unsupported type %T", eventType, k, v)
+		}
+		event[k] = v
+	}
+	event["eventType"] = eventType
+	event["timestamp"] = c.clock().Now().UnixNano() / int64(time.Millisecond)
+
+	c.eventsMu.Lock()
+	defer c.eventsMu.Unlock()
+	c.events = append(c.events, event)
+	c.trimEvents()
+	return nil
+}
+
+// DroppedEvents returns the number of events discarded because the buffer was
+// full
+func (c *Client) DroppedEvents() int64 {
+	return atomic.LoadInt64(&c.droppedEvents)
+}
+
+// FlushEvents immediately sends all buffered events to EventsURL, e.g. before
+// the process exits. Events that could not be sent are kept for the next
+// flush.
+func (c *Client) FlushEvents(ctx context.Context) error {
+	if c.EventsURL == "" {
+		return fmt.Errorf("no EventsURL configured")
+	}
+
+	c.eventsMu.Lock()
+	events := c.events
+	c.events = nil
+	c.eventsMu.Unlock()
+
+	for len(events) > 0 {
+		n := len(events)
+		if n > maxEventBatchSize {
+			n = maxEventBatchSize
+		}
+
+		if _, err := doPostGzip(ctx, events[:n], c.EventsURL, c.License, c.HTTPClient); err != nil {
+			Log(LogError, "ERROR: posting events: %v", err)
+			c.requeueEvents(events)
+			return err
+		}
+		events = events[n:]
+	}
+	return nil
+}
+
+// requeueEvents puts unsent events back in front of any recorded since
+func (c *Client) requeueEvents(events []model.Event) {
+	c.eventsMu.Lock()
+	defer c.eventsMu.Unlock()
+	c.events = append(events, c.events...)
+	c.trimEvents()
+}
+
+// trimEvents drops the oldest events beyond MaxEvents. The caller must hold
+// eventsMu.
+func (c *Client) trimEvents() {
+	max := c.MaxEvents
+	if max <= 0 {
+		max = DefaultMaxEvents
+	}
+	if excess := len(c.events) - max; excess > 0 {
+		c.events = c.events[excess:]
+		atomic.AddInt64(&c.droppedEvents, int64(excess))
+	}
+}
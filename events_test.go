@@ -0,0 +1,107 @@
+package newrelic
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/neocortical/newrelic/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RecordEvent_validation(t *testing.T) {
+	c := New("abc123")
+
+	assert.NotNil(t, c.RecordEvent("", nil))
+	assert.NotNil(t, c.RecordEvent("Deploy Finished", nil))
+	assert.NotNil(t, c.RecordEvent("Deploy", map[string]interface{}{"eventType": "Other"}))
+	assert.NotNil(t, c.RecordEvent("Deploy", map[string]interface{}{"timestamp": 1}))
+	assert.NotNil(t, c.RecordEvent("Deploy", map[string]interface{}{"tags": []string{"a"}}))
+	assert.NotNil(t, c.RecordEvent("Deploy", map[string]interface{}{"seconds": math.NaN()}))
+	assert.NotNil(t, c.RecordEvent("Deploy", map[string]interface{}{"seconds": float32(math.Inf(1))}))
+	assert.Nil(t, c.RecordEvent("Deploy", map[string]interface{}{"version": "1.2.3", "canary": true, "hosts": 3}))
+
+	assert.Equal(t, 1, len(c.events))
+}
+
+func Test_RecordEvent_maxEvents(t *testing.T) {
+	c := New("abc123")
+	c.MaxEvents = 2
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, c.RecordEvent("Job", map[string]interface{}{"n": i}))
+	}
+
+	assert.Equal(t, int64(3), c.DroppedEvents())
+	assert.Equal(t, 2, len(c.events))
+	assert.Equal(t, 3, c.events[0]["n"])
+	assert.Equal(t, 4, c.events[1]["n"])
+}
+
+func Test_FlushEvents(t *testing.T) {
+	status := http.StatusOK
+	var batches [][]model.Event
+	testSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "abc123", r.Header.Get("X-License-Key"))
+
+		zr, err := gzip.NewReader(r.Body)
+		assert.Nil(t, err)
+		var batch []model.Event
+		assert.Nil(t, json.NewDecoder(zr).Decode(&batch))
+		batches = append(batches, batch)
+		rw.WriteHeader(status)
+	}))
+	defer testSvr.Close()
+
+	c := New("abc123")
+	c.EventsURL = testSvr.URL
+	c.Clock = NewManualClock(time.Unix(1000, 0))
+
+	for i := 0; i < maxEventBatchSize+1; i++ {
+		c.RecordEvent("Job", map[string]interface{}{"n": i})
+	}
+	assert.Nil(t, c.FlushEvents(context.Background()))
+	assert.Equal(t, 2, len(batches))
+	assert.Equal(t, maxEventBatchSize, len(batches[0]))
+	assert.Equal(t, model.Event{"eventType": "Job", "timestamp": 1000000.0, "n": 1000.0}, batches[1][0])
+	assert.Equal(t, 0, len(c.events))
+
+	// failed events are kept for the next flush
+	status = http.StatusServiceUnavailable
+	c.RecordEvent("Deploy", nil)
+	assert.NotNil(t, c.FlushEvents(context.Background()))
+	assert.Equal(t, 1, len(c.events))
+
+	status = http.StatusOK
+	assert.Nil(t, c.FlushEvents(context.Background()))
+	assert.Equal(t, 0, len(c.events))
+	assert.Equal(t, "Deploy", batches[3][0]["eventType"])
+}
+
+func Test_ReportOnce_flushesEvents(t *testing.T) {
+	events := 0
+	testSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			events++
+		}
+	}))
+	defer testSvr.Close()
+
+	c := New("abc123")
+	c.URL = testSvr.URL
+	c.EventsURL = testSvr.URL
+	c.AddPlugin(testPlugin())
+
+	assert.Nil(t, c.ReportOnce(context.Background()))
+	assert.Equal(t, 0, events)
+
+	c.RecordEvent("Deploy", nil)
+	assert.Nil(t, c.ReportOnce(context.Background()))
+	assert.Equal(t, 1, events)
+}
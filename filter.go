@@ -0,0 +1,111 @@
+package newrelic
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/neocortical/newrelic/model"
+)
+
+// FilterValues wraps a metric so that every polled value passes through
+// filter, which may adjust the value or reject it by returning an error.
+// Rejected values are not reported and the error is included in the
+// request's CompositeError.
+//
+// An AggregateMetric such as a Recorder only keeps the minimum, maximum, total
+// and count of its samples, so an aggregate of several samples is reported
+// whole if the filter accepts its minimum and maximum unchanged, is rejected
+// if the filter rejects either, and is otherwise reduced to a single sample of
+// its filtered mean. Polls of m without samples, such as the first poll of a
+// delta metric, report none.
+func FilterValues(m Metric, filter func(float64) (float64, error)) Metric {
+	return &filteredMetric{metric: m, filter: filter}
+}
+
+// Clamp wraps a metric so that polled values are limited to [min, max]
+func Clamp(m Metric, min, max float64) Metric {
+	return FilterValues(m, func(val float64) (float64, error) {
+		return math.Max(min, math.Min(max, val)), nil
+	})
+}
+
+// RejectOutside wraps a metric so that polled values outside [min, max] are
+// treated as outliers and rejected
+func RejectOutside(m Metric, min, max float64) Metric {
+	return FilterValues(m, func(val float64) (float64, error) {
+		if val < min || val > max {
+			return val, fmt.Errorf("value %v outside of [%v, %v]", val, min, max)
+		}
+		return val, nil
+	})
+}
+
+type filteredMetric struct {
+	metric Metric
+	filter func(float64) (float64, error)
+}
+
+func (fm *filteredMetric) setClock(clock Clock) { setClock(fm.metric, clock) }
+
+func (fm *filteredMetric) Name() string  { return fm.metric.Name() }
+func (fm *filteredMetric) Units() string { return fm.metric.Units() }
+
+func (fm *filteredMetric) Poll() (float64, error) {
+	state, err := fm.PollAggregate()
+	if state.Count == 0 {
+		return 0, err
+	}
+	return state.Total / float64(state.Count), err
+}
+
+// PollAggregate implements AggregateMetric
+func (fm *filteredMetric) PollAggregate() (model.MetricValue, error) {
+	am, ok := fm.metric.(AggregateMetric)
+	if !ok {
+		val, err := fm.metric.Poll()
+		if err != nil {
+			return model.MetricValue{}, err
+		}
+		if val, err = fm.filter(val); err != nil {
+			return model.MetricValue{}, err
+		}
+		return updateState(model.MetricValue{}, val), nil
+	}
+
+	state, err := am.PollAggregate()
+	if state.Count == 0 {
+		return state, err
+	}
+	filtered, ferr := fm.filterAggregate(state)
+	if err != nil {
+		return filtered, err
+	}
+	return filtered, ferr
+}
+
+func (fm *filteredMetric) filterAggregate(state model.MetricValue) (model.MetricValue, error) {
+	if state.Count == 1 {
+		val, err := fm.filter(state.Total)
+		if err != nil {
+			return model.MetricValue{}, err
+		}
+		return updateState(model.MetricValue{}, val), nil
+	}
+
+	min, err := fm.filter(state.Min)
+	if err != nil {
+		return model.MetricValue{}, err
+	}
+	max, err := fm.filter(state.Max)
+	if err != nil {
+		return model.MetricValue{}, err
+	}
+	if min == state.Min && max == state.Max {
+		return state, nil
+	}
+	mean, err := fm.filter(state.Total / float64(state.Count))
+	if err != nil {
+		return model.MetricValue{}, err
+	}
+	return updateState(model.MetricValue{}, mean), nil
+}
@@ -0,0 +1,96 @@
+package newrelic
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/neocortical/newrelic/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Clamp(t *testing.T) {
+	val := 0.0
+	m := Clamp(NewMetric("foo", "bars", func() (float64, error) { return val, nil }), 0, 100)
+	assert.Equal(t, "foo", m.Name())
+	assert.Equal(t, "bars", m.Units())
+
+	for in, out := range map[float64]float64{-5: 0, 50: 50, 150: 100, math.Inf(1): 100} {
+		val = in
+		polled, err := m.Poll()
+		assert.Nil(t, err)
+		assert.Equal(t, out, polled)
+	}
+
+	// NaN passes through and is rejected when polled by a plugin
+	val = math.NaN()
+	_, err := pollMetric(m, stateOf(1))
+	assert.NotNil(t, err)
+}
+
+func Test_RejectOutside(t *testing.T) {
+	val := 0.0
+	m := RejectOutside(NewMetric("foo", "bars", func() (float64, error) { return val, nil }), 0, 100)
+
+	val = 50
+	polled, err := m.Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, 50.0, polled)
+
+	val = 1e9
+	_, err = m.Poll()
+	assert.NotNil(t, err)
+
+	state, err := pollMetric(m, stateOf(50))
+	assert.NotNil(t, err)
+	assert.Equal(t, stateOf(50), state)
+}
+
+func Test_FilterValues_passesErrors(t *testing.T) {
+	m := FilterValues(NewMetric("foo", "bars", func() (float64, error) { return 0, errors.New("derp") }),
+		func(val float64) (float64, error) { return val * 2, nil })
+	_, err := m.Poll()
+	assert.Equal(t, "derp", err.Error())
+}
+
+func Test_FilterValues_aggregates(t *testing.T) {
+	val := 10.0
+	delta := Clamp(NewDeltaMetric("foo", "bars", func() (float64, error) { return val, nil }), 0, 3)
+
+	// an unprimed delta has no sample to filter
+	state, err := pollMetric(delta, model.MetricValue{})
+	assert.Nil(t, err)
+	assert.Equal(t, model.MetricValue{}, state)
+	val = 12
+	state, err = pollMetric(delta, model.MetricValue{})
+	assert.Nil(t, err)
+	assert.Equal(t, stateOf(2), state)
+	val = 20
+	state, err = pollMetric(delta, model.MetricValue{})
+	assert.Nil(t, err)
+	assert.Equal(t, stateOf(3), state)
+
+	// aggregates within range are kept whole
+	recorder := NewRecorder("foo", "bars")
+	m := Clamp(recorder, 0, 100)
+	recorder.Record(1)
+	recorder.Record(3)
+	state, err = pollMetric(m, model.MetricValue{})
+	assert.Nil(t, err)
+	assert.Equal(t, model.MetricValue{Min: 1, Max: 3, Total: 4, Count: 2, SumOfSquares: 10}, state)
+	state, err = pollMetric(m, model.MetricValue{})
+	assert.Nil(t, err)
+	assert.Equal(t, model.MetricValue{}, state)
+
+	// and otherwise reduced to their filtered mean or rejected
+	recorder.Record(150)
+	recorder.Record(250)
+	state, err = pollMetric(m, model.MetricValue{})
+	assert.Nil(t, err)
+	assert.Equal(t, stateOf(100), state)
+
+	recorder.Record(50)
+	recorder.Record(500)
+	_, err = pollMetric(RejectOutside(recorder, 0, 100), model.MetricValue{})
+	assert.NotNil(t, err)
+}
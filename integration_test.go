@@ -23,6 +23,5 @@ func Test_doSend(t *testing.T) {
 	plugin.AddMetric(NewMetric("Test Metric", "rps", func() (float64, error) { return 1.0, nil }))
 	client.AddPlugin(plugin)
 
-	result := client.doSend(time.Now())
-	assert.False(t, result)
+	assert.Nil(t, client.doSend(time.Now()))
 }
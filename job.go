@@ -0,0 +1,108 @@
+package newrelic
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Job records metrics for a batch job or other short-lived process and reports
+// them in a single request when it finishes:
+//
+//	job, err := client.NewJob("Nightly Import", "com.example.newrelic.import")
+//	if err != nil {
+//		return err
+//	}
+//	defer job.Finish(context.Background())
+//
+//	job.Count("Rows/Imported", "rows", float64(n))
+//	job.Time("Batch/Duration", time.Since(start))
+type Job struct {
+	client  *Client
+	plugin  *Plugin
+	started time.Time
+
+	mu        sync.Mutex
+	counters  map[string]*Counter
+	recorders map[string]*Recorder
+}
+
+// NewJob creates a Job that reports as a new plugin on the client. The job's
+// report covers the time from now until Finish is called. Metric names passed
+// to the job are sanitized rather than rejected.
+func (c *Client) NewJob(name, guid string) (*Job, error) {
+	plugin := &Plugin{Name: name, GUID: guid, SanitizeNames: true}
+	if err := c.AddPlugin(plugin); err != nil {
+		return nil, err
+	}
+
+	return &Job{
+		client:    c,
+		plugin:    plugin,
+		started:   c.clock().Now(),
+		counters:  make(map[string]*Counter),
+		recorders: make(map[string]*Recorder),
+	}, nil
+}
+
+// Plugin returns the job's plugin, to which other metrics may be added
+func (j *Job) Plugin() *Plugin {
+	return j.plugin
+}
+
+// Count adds n to a counter, which is reported as a single total
+func (j *Job) Count(name, units string, n float64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	key := sanitizeMetricKey(name, units)
+	counter, ok := j.counters[key]
+	if !ok {
+		counter = NewCounter(name, units)
+		if err := j.plugin.AddMetric(counter); err != nil {
+			Log(LogError, "ERROR: job %s: %v", j.plugin.Name, err)
+			return
+		}
+		j.counters[key] = counter
+	}
+	counter.Add(n)
+}
+
+// Record a sample, which is reported along with every other sample of the
+// same metric as an aggregate
+func (j *Job) Record(name, units string, val float64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	key := sanitizeMetricKey(name, units)
+	recorder, ok := j.recorders[key]
+	if !ok {
+		recorder = NewRecorder(name, units)
+		if err := j.plugin.AddMetric(recorder); err != nil {
+			Log(LogError, "ERROR: job %s: %v", j.plugin.Name, err)
+			return
+		}
+		j.recorders[key] = recorder
+	}
+	recorder.Record(val)
+}
+
+// Time records a duration sample in milliseconds
+func (j *Job) Time(name string, d time.Duration) {
+	j.Record(name, "ms", float64(d)/float64(time.Millisecond))
+}
+
+// Finish synchronously reports everything recorded by the job, along with any
+// other plugins on the client. The report covers the time since the job was
+// created, or since the client's last report if that was later.
+func (j *Job) Finish(ctx context.Context) error {
+	j.client.sendMu.Lock()
+	defer j.client.sendMu.Unlock()
+
+	now := j.client.clock().Now()
+	since := j.started
+	if j.client.lastPollTime.After(since) {
+		since = j.client.lastPollTime
+	}
+	return j.client.report(ctx, now, minReportDuration(now.Sub(since)))
+}
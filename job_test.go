@@ -0,0 +1,131 @@
+package newrelic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/neocortical/newrelic/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Job(t *testing.T) {
+	var received model.Request
+	testSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer testSvr.Close()
+
+	mc := NewManualClock(time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC))
+	c := New("abc123")
+	c.Clock = mc
+	c.URL = testSvr.URL
+	c.HTTPClient = &http.Client{}
+
+	job, err := c.NewJob("Import", "com.example.import")
+	assert.Nil(t, err)
+	assert.Equal(t, []*Plugin{job.Plugin()}, c.Plugins)
+
+	job.Count("Rows", "rows", 10)
+	job.Count("Rows", "rows", 5)
+	job.Record("Batch/Size", "rows", 10)
+	job.Record("Batch/Size", "rows", 5)
+	job.Time("Batch/Duration", 1500*time.Millisecond)
+	mc.Advance(12 * time.Second)
+
+	assert.Nil(t, job.Finish(context.Background()))
+	assert.Equal(t, 1, len(received.Plugins))
+
+	p := received.Plugins[0]
+	assert.Equal(t, "Import", p.Name)
+	assert.Equal(t, "com.example.import", p.GUID)
+	assert.Equal(t, 12, p.DurationSec)
+	assert.Equal(t, 15.0, p.Metrics["Component/Rows[rows]"])
+	assert.Equal(t, 1500.0, p.Metrics["Component/Batch/Duration[ms]"])
+	assert.Equal(t, map[string]interface{}{
+		"min": 5.0, "max": 10.0, "total": 15.0, "count": 2.0, "sum_of_squares": 125.0,
+	}, p.Metrics["Component/Batch/Size[rows]"])
+}
+
+func Test_Job_afterTick(t *testing.T) {
+	var received model.Request
+	testSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer testSvr.Close()
+
+	mc := NewManualClock(time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC))
+	c := New("abc123")
+	c.Clock = mc
+	c.URL = testSvr.URL
+	c.HTTPClient = &http.Client{}
+
+	job, err := c.NewJob("Import", "com.example.import")
+	assert.Nil(t, err)
+	job.Count("Rows", "rows", 1)
+	mc.Advance(10 * time.Minute)
+	assert.Nil(t, c.Tick())
+
+	// the job's report covers only the time since the client's last report
+	job.Count("Rows", "rows", 1)
+	mc.Advance(10 * time.Second)
+	assert.Nil(t, job.Finish(context.Background()))
+	assert.Equal(t, 10, received.Plugins[0].DurationSec)
+}
+
+func Test_Job_minimumDuration(t *testing.T) {
+	var received model.Request
+	testSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer testSvr.Close()
+
+	c := New("abc123")
+	c.Clock = NewManualClock(time.Now())
+	c.URL = testSvr.URL
+	c.HTTPClient = &http.Client{}
+
+	job, err := c.NewJob("Import", "com.example.import")
+	assert.Nil(t, err)
+	job.Count("Rows", "rows", 1)
+	assert.Nil(t, job.Finish(context.Background()))
+	assert.Equal(t, 1, received.Plugins[0].DurationSec)
+}
+
+func Test_Job_sanitizedNames(t *testing.T) {
+	c := New("abc123")
+	job, err := c.NewJob("Import", "com.example.import")
+	assert.Nil(t, err)
+
+	// names that sanitize to the same key are counted together
+	job.Count("Rows[new]", "rows", 10)
+	job.Count("Rows(new)", "rows", 5)
+	job.Count("/Rows(new)/", "rows", 1)
+
+	request, err := c.GenerateRequest()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"Component/Rows(new)[rows]": 16.0}, request.Plugins[0].Metrics)
+}
+
+func Test_Job_whileReporting(t *testing.T) {
+	c := New("abc123")
+	job, err := c.NewJob("Import", "com.example.import")
+	assert.Nil(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 500; i++ {
+			job.Count(fmt.Sprintf("Rows/%d", i), "rows", 1)
+			job.Record(fmt.Sprintf("Batch/%d", i), "rows", 1)
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		c.GenerateRequest()
+	}
+	<-done
+}
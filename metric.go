@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"math"
+	"time"
 
 	"github.com/neocortical/newrelic/model"
 )
@@ -18,25 +19,53 @@ type Metric interface {
 type statefulMetric struct {
 	metric Metric
 	state  model.MetricValue
+
+	// dimState holds the samples not yet delivered to the Metric API, which
+	// accepts or rejects reports independently of the plugin API
+	dimState model.MetricValue
+
+	// lastGood is the last value reported and staleFor the time since the
+	// metric was last polled successfully
+	lastGood interface{}
+	staleFor time.Duration
+	errors   int64
 }
 
 func (sm *statefulMetric) generateMetricSnapshot() (result interface{}, err error) {
-	sm.state, err = pollMetric(sm.metric, sm.state)
-	if err == nil {
-		if sm.state.Count == 1 {
-			result = sm.state.Total
-		} else {
-			result = sm.state
-		}
+	polled, err := pollMetric(sm.metric, model.MetricValue{})
+	if err != nil && polled.Count == 0 {
+		return nil, err
+	}
+	state, dimState := mergeState(sm.state, polled), mergeState(sm.dimState, polled)
+	if !finiteState(state) || !finiteState(dimState) {
+		return nil, fmt.Errorf("%s error: aggregate is not finite", sm.metric.Name())
 	}
+	sm.state, sm.dimState = state, dimState
 
-	return result, err
+	// samples polled along with an error are reported with it
+	return sm.snapshotValue(), err
+}
+
+// snapshotValue returns the current state as reported to the API. Aggregate
+// metrics may have no samples, leaving nothing to report.
+func (sm *statefulMetric) snapshotValue() interface{} {
+	switch sm.state.Count {
+	case 0:
+		return nil
+	case 1:
+		return sm.state.Total
+	}
+	return sm.state
 }
 
 func (sm *statefulMetric) clearState() {
 	sm.state = model.MetricValue{}
 }
 
+func (sm *statefulMetric) clearDimState() {
+	sm.dimState = model.MetricValue{}
+}
+
 // NewMetric creates a new metric definition using a closure
 func NewMetric(name, units string, pollFn func() (float64, error)) Metric {
 	return &simpleMetric{
@@ -56,13 +85,45 @@ func (sm *simpleMetric) Name() string           { return sm.name }
 func (sm *simpleMetric) Units() string          { return sm.units }
 func (sm *simpleMetric) Poll() (float64, error) { return sm.poll() }
 
+// pollMetric polls a metric and merges its samples into state. Samples
+// returned along with an error are kept.
 func pollMetric(metric Metric, state model.MetricValue) (model.MetricValue, error) {
+	val, err := pollSamples(metric)
+	next := mergeState(state, val)
+
+	// a single non-finite field would make the whole request unencodable
+	if !finiteState(next) {
+		return state, fmt.Errorf("%s error: aggregate is not finite", metric.Name())
+	}
+	if err != nil {
+		return next, fmt.Errorf("%s error: %v", metric.Name(), err)
+	}
+	return next, nil
+}
+
+// pollSamples polls the samples of a metric since its previous poll
+func pollSamples(metric Metric) (model.MetricValue, error) {
+	if am, ok := metric.(AggregateMetric); ok {
+		return am.PollAggregate()
+	}
+
 	val, err := metric.Poll()
 	if err != nil {
-		return state, fmt.Errorf("%s error: %v", metric.Name(), err)
+		return model.MetricValue{}, err
 	}
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return model.MetricValue{}, fmt.Errorf("non-finite value %v", val)
+	}
+	return updateState(model.MetricValue{}, val), nil
+}
 
-	return updateState(state, val), nil
+func finiteState(state model.MetricValue) bool {
+	for _, f := range []float64{state.Min, state.Max, state.Total, state.SumOfSquares} {
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return false
+		}
+	}
+	return true
 }
 
 func updateState(state model.MetricValue, val float64) model.MetricValue {
@@ -79,12 +140,31 @@ func updateState(state model.MetricValue, val float64) model.MetricValue {
 	return state
 }
 
+func mergeState(state, val model.MetricValue) model.MetricValue {
+	if val.Count == 0 {
+		return state
+	}
+	if state.Count == 0 {
+		return val
+	}
+	state.Min = math.Min(val.Min, state.Min)
+	state.Max = math.Max(val.Max, state.Max)
+	state.Total += val.Total
+	state.Count += val.Count
+	state.SumOfSquares += val.SumOfSquares
+	return state
+}
+
 func generateMetricKey(m Metric) string {
+	return metricKey(m.Name(), m.Units())
+}
+
+func metricKey(name, units string) string {
 	var buf bytes.Buffer
 	buf.WriteString("Component/")
-	buf.WriteString(m.Name())
+	buf.WriteString(name)
 	buf.WriteRune('[')
-	buf.WriteString(m.Units())
+	buf.WriteString(units)
 	buf.WriteRune(']')
 	return buf.String()
 }
@@ -1,8 +1,11 @@
 package newrelic
 
 import (
+	"encoding/json"
 	"errors"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/neocortical/newrelic/model"
 	"github.com/stretchr/testify/assert"
@@ -111,3 +114,45 @@ func Test_simpleMetricsGroup_generateMetricsSnapshots(t *testing.T) {
 	assert.True(t, ok)
 	assert.Equal(t, model.MetricValue{Min: 1.0, Max: 2.0, Total: 3.0, Count: 2, SumOfSquares: 5.0}, aggVal)
 }
+
+func stateOf(vals ...float64) (st model.MetricValue) {
+	for _, v := range vals {
+		st = updateState(st, v)
+	}
+	return st
+}
+
+func Test_pollMetric_rejectsNonFinite(t *testing.T) {
+	for _, bad := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		m := NewMetric("foo", "bars", func() (float64, error) { return bad, nil })
+		state, err := pollMetric(m, stateOf(1, 2))
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "non-finite")
+		assert.Equal(t, stateOf(1, 2), state)
+	}
+
+	// squaring a huge value overflows the sum of squares
+	m := NewMetric("foo", "bars", func() (float64, error) { return 1e200, nil })
+	state, err := pollMetric(m, stateOf(1))
+	assert.NotNil(t, err)
+	assert.Equal(t, stateOf(1), state)
+
+	r := NewRecorder("foo", "bars")
+	r.Record(1)
+	r.Record(math.NaN())
+	state, err = pollMetric(r, model.MetricValue{})
+	assert.NotNil(t, err)
+	assert.Equal(t, model.MetricValue{}, state)
+}
+
+func Test_generateRequest_nonFiniteMetricIsolated(t *testing.T) {
+	p := &Plugin{Name: "foo", GUID: "com.example.foo"}
+	p.AddMetric(NewMetric("good", "bars", func() (float64, error) { return 1, nil }))
+	p.AddMetric(NewMetric("bad", "bars", func() (float64, error) { return math.NaN(), nil }))
+	c := &Client{PollInterval: time.Minute, Plugins: []*Plugin{p}}
+
+	request, _ := c.generateRequest(time.Now())
+	_, err := json.Marshal(request)
+	assert.Nil(t, err)
+	assert.Equal(t, 1.0, request.Plugins[0].Metrics["Component/good[bars]"])
+}
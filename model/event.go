@@ -0,0 +1,5 @@
+package model
+
+// Event is a single custom event for the Insights insert API. Besides its
+// attributes it holds the reserved eventType and timestamp keys.
+type Event map[string]interface{}
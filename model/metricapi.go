@@ -0,0 +1,40 @@
+package model
+
+// Metric API metric types
+const (
+	MetricTypeGauge   = "gauge"
+	MetricTypeCount   = "count"
+	MetricTypeSummary = "summary"
+)
+
+// MetricAPIRequest is the container that holds a dimensional Metric API request
+type MetricAPIRequest []MetricBatch
+
+// MetricBatch is a set of metrics sharing common attributes
+type MetricBatch struct {
+	Common  MetricCommon        `json:"common"`
+	Metrics []DimensionalMetric `json:"metrics"`
+}
+
+// MetricCommon holds the fields shared by every metric in a batch
+type MetricCommon struct {
+	Timestamp  int64                  `json:"timestamp"`
+	IntervalMs int64                  `json:"interval.ms"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// DimensionalMetric is a single gauge, count or summary
+type DimensionalMetric struct {
+	Name       string                 `json:"name"`
+	Type       string                 `json:"type"`
+	Value      interface{}            `json:"value"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// SummaryValue is the value of a summary metric
+type SummaryValue struct {
+	Count float64 `json:"count"`
+	Sum   float64 `json:"sum"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
@@ -1,11 +1,20 @@
 package newrelic
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
 	"net"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/neocortical/newrelic/model"
@@ -19,8 +28,14 @@ const (
 const (
 	agentVersion = "0.0.1"
 	apiEndpoint  = "https://platform-api.newrelic.com/platform/v1/metrics"
+
+	// maxErrorBodySize limits how much of an error response is kept
+	maxErrorBodySize = 1024
 )
 
+// randInt63n is replaced in tests
+var randInt63n = rand.Int63n
+
 var netTransport = &http.Transport{
 	Dial: (&net.Dialer{
 		Timeout:   5 * time.Second,
@@ -36,54 +51,234 @@ var netClient = &http.Client{
 
 // Client encapsulates a NewRelic plugin client and all the plugins it reports
 type Client struct {
-	License      string
+	License string
+
+	// PollInterval is the length of a report cycle. DefaultPollInterval is
+	// used if it isn't positive.
 	PollInterval time.Duration
-	Plugins      []*Plugin
+
+	// Plugins may be appended to directly before the client is started.
+	// Use AddPlugin afterwards.
+	Plugins []*Plugin
 
 	// HTTPClient is exposed to allow users to configure proxies, etc.
 	HTTPClient *http.Client
 
+	// URL is the platform API endpoint. Override it to report through a relay
+	// or to a fake collector in tests.
+	URL string
+
+	// MetricAPIURL, if set, is a dimensional Metric API endpoint (usually
+	// MetricAPIEndpoint) that receives every report as well. Clear URL to
+	// report to the Metric API only. Each endpoint keeps the data it fails to
+	// accept for its next report, independently of the other.
+	MetricAPIURL string
+
+	// MetricPrefix is prepended to the metric names of every plugin. It may
+	// refer to $variables as described for Plugin.MetricPrefix.
+	MetricPrefix string
+
+	// Labels are user-defined variables for MetricPrefix, shared by plugins
+	Labels map[string]string
+
+	// EventsURL, if set, is the Insights insert endpoint (see EventsEndpoint)
+	// that recorded events are flushed to on every report cycle
+	EventsURL string
+
+	// MaxEvents limits how many events are buffered between flushes. The
+	// oldest events are dropped once it is reached. The default is
+	// DefaultMaxEvents.
+	MaxEvents int
+
+	// Clock schedules report cycles. The system clock is used when nil.
+	Clock Clock
+
+	// AlignCycles schedules report cycles on wall-clock multiples of
+	// PollInterval (e.g. on the minute) instead of relative to Run.
+	AlignCycles bool
+
+	// StartJitter delays the first report cycle, and so every cycle after it,
+	// by a random amount up to StartJitter. This spreads out fleets of clients
+	// that were all started at the same time.
+	StartJitter time.Duration
+
 	agent        model.Agent
+	created      time.Time
 	lastPollTime time.Time
-	url          string
+	overruns     int64
+	running      int32
+
+	// pluginsMu guards Plugins, so that plugins can be added while running
+	pluginsMu sync.Mutex
+
+	eventsMu      sync.Mutex
+	events        []model.Event
+	droppedEvents int64
+
+	// sendMu keeps report cycles from running concurrently
+	sendMu sync.Mutex
 }
 
 // AddPlugin appends a plugin to a clients list of plugins. A plugin is a "component"
 // in the API call and can be configured (with a unique GUID) in the NewRelic UI.
-func (c *Client) AddPlugin(p *Plugin) {
+// Plugins with an invalid name or GUID are rejected, as are plugins that would
+// report as the same component (same GUID and name) as one already added.
+// Plugins may be added after the client has started, but must be fully
+// configured first.
+func (c *Client) AddPlugin(p *Plugin) error {
+	if err := ValidatePlugin(p); err != nil {
+		return err
+	}
+
+	c.pluginsMu.Lock()
+	defer c.pluginsMu.Unlock()
+	for _, existing := range c.Plugins {
+		if sameComponent(existing, p) {
+			return fmt.Errorf("duplicate plugin %s with GUID %s", p.Name, p.GUID)
+		}
+	}
 	c.Plugins = append(c.Plugins, p)
+	return nil
+}
+
+// Validate checks every plugin on the client, including any appended to
+// Plugins directly, and reports all invalid or duplicate plugins
+func (c *Client) Validate() error {
+	plugins := c.plugins()
+
+	var err CompositeError
+	for i, p := range plugins {
+		err = err.Accumulate(ValidatePlugin(p))
+		for _, other := range plugins[:i] {
+			if sameComponent(other, p) {
+				err = err.Accumulate(fmt.Errorf("duplicate plugin %s with GUID %s", p.Name, p.GUID))
+				break
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// plugins returns the plugins added so far
+func (c *Client) plugins() []*Plugin {
+	c.pluginsMu.Lock()
+	defer c.pluginsMu.Unlock()
+	return c.Plugins[:len(c.Plugins):len(c.Plugins)]
+}
+
+// sameComponent reports whether two plugins would be indistinguishable in the
+// API. Several components may share a GUID as long as their names differ,
+// e.g. one component per monitored server.
+func sameComponent(a, b *Plugin) bool {
+	return a == b || (a.GUID == b.GUID && a.Name == b.Name)
 }
 
-// New creates a new Client with the given license
+// New creates a new Client with the given license. It panics if the host name
+// can't be determined; use NewClient to handle that error or to override the
+// agent's identity.
 func New(license string) *Client {
+	result, err := NewClient(license)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+// NewClient creates a new Client with the given license and options. The
+// agent's host defaults to the system host name, which is an error if it can't
+// be determined and no option sets the host.
+func NewClient(license string, opts ...Option) (*Client, error) {
 	result := &Client{
 		License:      license,
 		PollInterval: DefaultPollInterval,
 		HTTPClient:   netClient,
-		url:          apiEndpoint,
+		URL:          apiEndpoint,
+		created:      time.Now(),
 	}
 
 	result.agent.Version = agentVersion
 	result.agent.PID = os.Getpid()
-	var err error
-	if result.agent.Host, err = os.Hostname(); err != nil {
-		panic(err)
+
+	var err CompositeError
+	for _, opt := range opts {
+		err = err.Accumulate(opt(result))
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return result
+	if result.agent.Host == "" {
+		host, herr := os.Hostname()
+		if herr != nil {
+			return nil, fmt.Errorf("error getting host name: %v", herr)
+		}
+		result.agent.Host = host
+	}
+	return result, nil
+}
+
+// Agent returns the agent identity the client reports
+func (c *Client) Agent() model.Agent {
+	return c.agent
+}
+
+func (c *Client) doSend(t time.Time) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	return c.report(context.Background(), t, c.cycleDuration(t))
 }
 
-func (c *Client) doSend(t time.Time) {
-	request, err := c.generateRequest(t)
+// report polls all plugins for a cycle of the given duration ending at t and
+// posts the result. Errors generating the request do not prevent sending it.
+// The caller must hold sendMu.
+func (c *Client) report(ctx context.Context, t time.Time, duration time.Duration) error {
+	request, err := c.generateRequestForDuration(duration)
 	if err != nil {
 		Log(LogError, "ERROR: encountered error(s) creating request data: %v", err)
 	}
 	c.lastPollTime = t
 
-	responseCode := doPost(request, c.url, c.License, c.HTTPClient)
+	// each endpoint keeps its own state until it accepts the data, so that
+	// one rejecting a report doesn't make the other receive samples twice.
+	// The state of an endpoint that isn't configured is discarded.
+	if c.URL != "" {
+		responseCode, postErr := doPost(ctx, request, c.URL, c.License, c.HTTPClient)
+		if handleResponse(responseCode) {
+			c.clearState()
+		}
+		err = err.Accumulate(postErr)
+	} else {
+		c.clearState()
+	}
+	if c.MetricAPIURL != "" {
+		_, postErr := doPost(ctx, c.generateMetricAPIRequest(t), c.MetricAPIURL, c.License, c.HTTPClient)
+		if postErr != nil {
+			Log(LogError, "ERROR: posting to the Metric API: %v", postErr)
+		} else {
+			c.clearDimensionalState()
+		}
+		err = err.Accumulate(postErr)
+	} else {
+		c.clearDimensionalState()
+	}
+	if c.EventsURL != "" {
+		err = err.Accumulate(c.FlushEvents(ctx))
+	}
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// handleResponse logs a plugin API response and reports whether it accepted
+// the data
+func handleResponse(responseCode int) bool {
 	switch responseCode {
 	case http.StatusOK:
-		c.clearState()
+		return true
 	case http.StatusBadRequest:
 		logResponseError(responseCode)
 	case http.StatusForbidden:
@@ -103,29 +298,184 @@ func (c *Client) doSend(t time.Time) {
 	case http.StatusTeapot:
 		Log(LogError, "Server is a teapot!")
 	}
+	return false
+}
+
+// ReportOnce polls all plugins and synchronously sends a single report. It is
+// meant for batch jobs and other processes too short-lived for Run. The report
+// covers the time since the previous report, or since the client was created.
+// The returned error includes any metric errors and, if the post failed, a
+// *ResponseError or transport error.
+func (c *Client) ReportOnce(ctx context.Context) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	now := c.clock().Now()
+
+	since := c.lastPollTime
+	if since.IsZero() {
+		since = c.created
+	}
+	duration := c.pollInterval()
+	if !since.IsZero() {
+		duration = now.Sub(since)
+	}
+
+	return c.report(ctx, now, minReportDuration(duration))
+}
+
+// GenerateRequest polls all plugins once and returns the request a report
+// cycle of a full poll interval would send, without sending it. It doesn't
+// change the time the next report covers. Polling takes the samples from
+// counters and recorders, which are kept and sent with the next report.
+func (c *Client) GenerateRequest() (model.Request, error) {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	// polling for no time leaves plugin durations and staleness as they were
+	request, err := c.generateRequestForDuration(0)
+	for i := range request.Plugins {
+		request.Plugins[i].DurationSec += int(c.pollInterval() / time.Second)
+	}
+	if err != nil {
+		return request, err
+	}
+	return request, nil
+}
+
+// minReportDuration keeps very short reports from rounding down to a zero
+// second duration, which the API rejects
+func minReportDuration(duration time.Duration) time.Duration {
+	if duration < time.Second {
+		return time.Second
+	}
+	return duration
+}
+
+// SendSnapshots posts pre-built component snapshots using the client's agent
+// info, license and HTTP client. It is intended for exporters that aggregate
+// data outside of the Plugin/Metric model and bypasses plugin state entirely.
+func (c *Client) SendSnapshots(snapshots []model.PluginSnapshot) error {
+	request := model.Request{
+		Agent:   c.agent,
+		Plugins: snapshots,
+	}
+
+	_, err := doPost(context.Background(), request, c.URL, c.License, c.HTTPClient)
+	if err != nil {
+		Log(LogError, "ERROR: %v", err)
+	}
+	return err
 }
 
 func (c *Client) clearState() {
-	for _, p := range c.Plugins {
+	for _, p := range c.plugins() {
 		p.clearState()
 	}
 }
 
-// Run starts the NewRelic client asynchronously. Do not alter the configuration
-// of plugins after starting the client, as this creates race conditions.
+func (c *Client) clearDimensionalState() {
+	for _, p := range c.plugins() {
+		p.clearDimensionalState()
+	}
+}
+
+// Run starts the NewRelic client asynchronously. Plugins may still be added
+// with AddPlugin or Register, and metrics and sources added to plugins, after
+// the client has started; other plugin settings must not be changed. Run does
+// nothing if the client has already been started.
 func (c *Client) Run() {
+	if !atomic.CompareAndSwapInt32(&c.running, 0, 1) {
+		return
+	}
 	Log(LogInfo, "Starting NewRelic plugin client...")
 	go c.run()
 }
 
+// Flush polls all plugins and sends a report for the cycle ending at now.
+// Together with a ManualClock it allows tests and batch jobs to drive report
+// cycles without waiting on the poll interval.
+func (c *Client) Flush(now time.Time) error {
+	return c.doSend(now)
+}
+
+// Tick flushes a report for the cycle ending at the clock's current time
+func (c *Client) Tick() error {
+	return c.Flush(c.clock().Now())
+}
+
+func (c *Client) pollInterval() time.Duration {
+	if c.PollInterval <= 0 {
+		return DefaultPollInterval
+	}
+	return c.PollInterval
+}
+
+func (c *Client) clock() Clock {
+	if c.Clock == nil {
+		return systemClock{}
+	}
+	return c.Clock
+}
+
+// Overruns returns the number of report cycles that were skipped because a
+// previous cycle was still sending when they were due
+func (c *Client) Overruns() int64 {
+	return atomic.LoadInt64(&c.overruns)
+}
+
 func (c *Client) run() {
-	ticks := time.Tick(time.Duration(c.PollInterval))
-	for t := range ticks {
+	clock := c.clock()
+	now := clock.Now()
+	interval := c.pollInterval()
+
+	c.sendMu.Lock()
+	if c.lastPollTime.IsZero() {
+		c.lastPollTime = now
+	}
+	c.sendMu.Unlock()
+
+	next := c.firstCycle(now)
+	for {
+		t := <-clock.After(next.Sub(clock.Now()))
 		c.doSend(t)
+
+		// skip cycles that were due while sending. their data is not lost, the
+		// next report simply covers a longer duration.
+		next = next.Add(interval)
+		if now := clock.Now(); !next.After(now) {
+			missed := now.Sub(next)/interval + 1
+			next = next.Add(missed * interval)
+			atomic.AddInt64(&c.overruns, int64(missed))
+			Log(LogError, "ERROR: report cycle at %v overran the poll interval, skipped %d cycle(s)", t, missed)
+		}
+	}
+}
+
+func (c *Client) firstCycle(now time.Time) time.Time {
+	interval := c.pollInterval()
+	next := now.Add(interval)
+	if c.AlignCycles {
+		next = now.Truncate(interval).Add(interval)
+	}
+	if c.StartJitter > 0 {
+		next = next.Add(time.Duration(randInt63n(int64(c.StartJitter))))
 	}
+	return next
+}
+
+// doPost posts a JSON payload. Any 2xx response is a success, as the Metric
+// API replies 202 Accepted.
+func doPost(ctx context.Context, request interface{}, url, license string, client *http.Client) (int, error) {
+	return post(ctx, request, url, license, client, false)
 }
 
-func doPost(request model.Request, url, license string, client *http.Client) int {
+// doPostGzip posts a gzip-compressed JSON payload
+func doPostGzip(ctx context.Context, request interface{}, url, license string, client *http.Client) (int, error) {
+	return post(ctx, request, url, license, client, true)
+}
+
+func post(ctx context.Context, request interface{}, url, license string, client *http.Client, compress bool) (int, error) {
 	var jsonBytes []byte
 	var err error
 	if LogLevel <= LogDebug {
@@ -135,28 +485,51 @@ func doPost(request model.Request, url, license string, client *http.Client) int
 	}
 	if err != nil {
 		Log(LogError, "error encoding json request: %v", err)
-		return http.StatusBadRequest
+		return http.StatusBadRequest, fmt.Errorf("error encoding json request: %v", err)
 	}
 
 	Log(LogDebug, "Posting request:\n%s", string(jsonBytes))
 
-	httpRequest, err := http.NewRequest("POST", url, strings.NewReader(string(jsonBytes)))
+	var body io.Reader = bytes.NewReader(jsonBytes)
+	if compress {
+		buf := &bytes.Buffer{}
+		zw := gzip.NewWriter(buf)
+		zw.Write(jsonBytes)
+		if err = zw.Close(); err != nil {
+			return http.StatusBadRequest, fmt.Errorf("error compressing request: %v", err)
+		}
+		body = buf
+	}
+
+	httpRequest, err := http.NewRequest("POST", url, body)
 	if err != nil {
 		Log(LogError, "error creating request: %v", err)
-		return http.StatusBadRequest
+		return http.StatusBadRequest, fmt.Errorf("error creating request: %v", err)
 	}
+	httpRequest = httpRequest.WithContext(ctx)
 
 	httpRequest.Header.Set("X-License-Key", license)
 	httpRequest.Header.Set("Content-Type", "application/json")
 	httpRequest.Header.Set("Accept", "application/json")
+	if compress {
+		httpRequest.Header.Set("Content-Encoding", "gzip")
+	}
 
 	httpResponse, err := client.Do(httpRequest)
 	if err != nil {
 		Log(LogError, "error posting request: %v", err)
-		return http.StatusServiceUnavailable
+		return http.StatusServiceUnavailable, fmt.Errorf("error posting request: %v", err)
 	}
 	defer httpResponse.Body.Close()
-	return httpResponse.StatusCode
+
+	if httpResponse.StatusCode < 200 || httpResponse.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(httpResponse.Body, maxErrorBodySize))
+		return httpResponse.StatusCode, &ResponseError{
+			StatusCode: httpResponse.StatusCode,
+			Body:       strings.TrimSpace(string(body)),
+		}
+	}
+	return httpResponse.StatusCode, nil
 }
 
 func logResponseError(responseCode int) {
@@ -164,17 +537,23 @@ func logResponseError(responseCode int) {
 }
 
 func (c *Client) generateRequest(t time.Time) (request model.Request, err CompositeError) {
-	request.Agent = c.agent
+	return c.generateRequestForDuration(c.cycleDuration(t))
+}
 
-	var duration time.Duration
+// cycleDuration returns the length of the report cycle ending at t
+func (c *Client) cycleDuration(t time.Time) time.Duration {
 	if c.lastPollTime.IsZero() {
-		duration = c.PollInterval
-	} else {
-		duration = t.Sub(c.lastPollTime)
+		return c.pollInterval()
 	}
+	return t.Sub(c.lastPollTime)
+}
+
+func (c *Client) generateRequestForDuration(duration time.Duration) (request model.Request, err CompositeError) {
+	request.Agent = c.agent
+	naming := c.naming()
 
-	for _, p := range c.Plugins {
-		pluginSnapshot, cerr := p.generatePluginSnapshot(duration)
+	for _, p := range c.plugins() {
+		pluginSnapshot, cerr := p.snapshot(duration, naming)
 
 		// we are tolerant of request generation errors and should be able to recover
 		if cerr != nil {
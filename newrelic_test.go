@@ -1,6 +1,9 @@
 package newrelic
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -31,12 +34,40 @@ func Test_AddPlugin(t *testing.T) {
 	client.AddPlugin(&Plugin{Name: "foo", GUID: "com.example.foo"})
 	assert.Equal(t, 1, len(client.Plugins))
 
-	client.AddPlugin(&Plugin{Name: "bar", GUID: "com.example.bar"})
+	assert.Nil(t, client.AddPlugin(&Plugin{Name: "bar", GUID: "com.example.bar"}))
 	assert.Equal(t, 2, len(client.Plugins))
 	assert.Equal(t, "foo", client.Plugins[0].Name)
 	assert.Equal(t, "com.example.foo", client.Plugins[0].GUID)
 	assert.Equal(t, "bar", client.Plugins[1].Name)
 	assert.Equal(t, "com.example.bar", client.Plugins[1].GUID)
+
+	assert.NotNil(t, client.AddPlugin(&Plugin{Name: "baz", GUID: "baz"}))
+	assert.Equal(t, 2, len(client.Plugins))
+
+	// components may share a GUID but not a GUID and name
+	assert.Nil(t, client.AddPlugin(&Plugin{Name: "foo2", GUID: "com.example.foo"}))
+	assert.NotNil(t, client.AddPlugin(&Plugin{Name: "foo", GUID: "com.example.foo"}))
+	assert.NotNil(t, client.AddPlugin(client.Plugins[0]))
+	assert.Equal(t, 3, len(client.Plugins))
+}
+
+func Test_Validate(t *testing.T) {
+	client := New("abc123")
+	assert.Nil(t, client.Validate())
+
+	client.Plugins = []*Plugin{
+		{Name: "foo", GUID: "com.example.foo"},
+		{Name: "bar", GUID: "com.example.foo"},
+	}
+	assert.Nil(t, client.Validate())
+
+	client.Plugins = append(client.Plugins,
+		&Plugin{Name: "foo", GUID: "com.example.foo"},
+		&Plugin{Name: "baz", GUID: "baz"},
+	)
+	err := client.Validate()
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, len(err.(CompositeError)))
 }
 
 func Test_generateRequest_agentAndDurationMath(t *testing.T) {
@@ -134,7 +165,7 @@ func Test_doSend_lastPollTimeUpdated(t *testing.T) {
 		},
 		lastPollTime: t0,
 		HTTPClient:   &http.Client{},
-		url:          testSvr.URL,
+		URL:          testSvr.URL,
 	}
 
 	t1 := t0
@@ -150,9 +181,209 @@ func Test_New(t *testing.T) {
 
 	assert.Equal(t, "abc123", nr.License)
 	assert.Equal(t, DefaultPollInterval, nr.PollInterval)
-	assert.Equal(t, apiEndpoint, nr.url)
+	assert.Equal(t, apiEndpoint, nr.URL)
 	assert.Equal(t, agentVersion, nr.agent.Version)
 	assert.Equal(t, os.Getpid(), nr.agent.PID)
 	host, _ := os.Hostname()
 	assert.Equal(t, host, nr.agent.Host)
 }
+
+func Test_SendSnapshots(t *testing.T) {
+	var status int
+	var received model.Request
+	testSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		rw.WriteHeader(status)
+	}))
+	defer testSvr.Close()
+
+	c := New("abc123")
+	c.HTTPClient = &http.Client{}
+	c.URL = testSvr.URL
+
+	snapshots := []model.PluginSnapshot{
+		{Name: "MyPlugin", GUID: "com.example.myplugin", DurationSec: 60, Metrics: map[string]interface{}{"Component/foo[bars]": 1.0}},
+	}
+
+	status = http.StatusOK
+	assert.Nil(t, c.SendSnapshots(snapshots))
+	assert.Equal(t, c.agent, received.Agent)
+	assert.Equal(t, snapshots, received.Plugins)
+
+	status = http.StatusForbidden
+	assert.NotNil(t, c.SendSnapshots(snapshots))
+}
+
+func testPlugin() *Plugin {
+	return &Plugin{
+		Name: "MyPlugin",
+		GUID: "com.example.myplugin",
+		metrics: map[string]*statefulMetric{
+			"foo": &statefulMetric{
+				metric: NewMetric("foo", "bars", func() (float64, error) { return 1.0, nil }),
+			},
+		},
+	}
+}
+
+func Test_Tick_usesClock(t *testing.T) {
+	requests := make(chan model.Request, 10)
+	testSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var req model.Request
+		json.NewDecoder(r.Body).Decode(&req)
+		requests <- req
+	}))
+	defer testSvr.Close()
+
+	t0 := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	mc := NewManualClock(t0)
+
+	c := New("abc123")
+	c.Clock = mc
+	c.URL = testSvr.URL
+	c.HTTPClient = &http.Client{}
+	c.AddPlugin(testPlugin())
+
+	// first cycle reports the poll interval
+	c.Tick()
+	assert.Equal(t, t0, c.lastPollTime)
+	assert.Equal(t, 60, (<-requests).Plugins[0].DurationSec)
+
+	mc.Advance(30 * time.Second)
+	c.Tick()
+	assert.Equal(t, t0.Add(30*time.Second), c.lastPollTime)
+	assert.Equal(t, 30, (<-requests).Plugins[0].DurationSec)
+
+	c.Flush(t0.Add(75 * time.Second))
+	assert.Equal(t, 45, (<-requests).Plugins[0].DurationSec)
+}
+
+func Test_run_manualClock(t *testing.T) {
+	requests := make(chan model.Request, 10)
+	testSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var req model.Request
+		json.NewDecoder(r.Body).Decode(&req)
+		requests <- req
+	}))
+	defer testSvr.Close()
+
+	t0 := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	mc := NewManualClock(t0)
+
+	c := New("abc123")
+	c.Clock = mc
+	c.URL = testSvr.URL
+	c.HTTPClient = &http.Client{}
+	c.AddPlugin(testPlugin())
+	c.Run()
+
+	waitForWaiter(t, mc)
+	mc.Advance(time.Minute)
+	<-requests
+	waitForWaiter(t, mc)
+	assert.Equal(t, t0.Add(time.Minute), c.lastPollTime)
+
+	// skipping several intervals at once only sends one report
+	mc.Advance(3*time.Minute + 30*time.Second)
+	<-requests
+	waitForWaiter(t, mc)
+	assert.Equal(t, 0, len(requests))
+	assert.Equal(t, t0.Add(4*time.Minute+30*time.Second), c.lastPollTime)
+
+	mc.Advance(30 * time.Second)
+	assert.Equal(t, 30, (<-requests).Plugins[0].DurationSec)
+}
+
+func waitForWaiter(t *testing.T, mc *ManualClock) {
+	deadline := time.Now().Add(5 * time.Second)
+	for mc.Waiters() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for run loop")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func Test_ReportOnce(t *testing.T) {
+	status := http.StatusOK
+	var received model.Request
+	testSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		if status != http.StatusOK {
+			http.Error(rw, "invalid license", status)
+		}
+	}))
+	defer testSvr.Close()
+
+	c := New("abc123")
+	c.URL = testSvr.URL
+	c.HTTPClient = &http.Client{}
+	c.AddPlugin(testPlugin())
+	c.created = time.Now().Add(-5 * time.Second)
+
+	// first report covers the time since the client was created
+	assert.Nil(t, c.ReportOnce(context.Background()))
+	assert.Equal(t, 5, received.Plugins[0].DurationSec)
+	assert.False(t, c.lastPollTime.IsZero())
+
+	status = http.StatusForbidden
+	c.lastPollTime = time.Now().Add(-3 * time.Second)
+	err := c.ReportOnce(context.Background())
+	assert.NotNil(t, err)
+	ce, ok := err.(CompositeError)
+	assert.True(t, ok)
+	assert.Equal(t, &ResponseError{StatusCode: http.StatusForbidden, Body: "invalid license"}, ce[0])
+	assert.Equal(t, 3, received.Plugins[0].DurationSec)
+}
+
+func Test_ReportOnce_metricErrors(t *testing.T) {
+	testSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	defer testSvr.Close()
+
+	c := New("abc123")
+	c.URL = testSvr.URL
+	c.HTTPClient = &http.Client{}
+	p := &Plugin{Name: "MyPlugin", GUID: "com.example.myplugin"}
+	p.AddMetric(NewMetric("foo", "bars", func() (float64, error) { return 0, errors.New("derp") }))
+	c.AddPlugin(p)
+
+	err := c.ReportOnce(context.Background())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "derp")
+}
+
+func Test_ReportOnce_cancellation(t *testing.T) {
+	testSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	defer testSvr.Close()
+
+	c := &Client{
+		License:      "abc123",
+		PollInterval: time.Minute,
+		HTTPClient:   &http.Client{},
+		URL:          testSvr.URL,
+	}
+	c.AddPlugin(testPlugin())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := c.ReportOnce(ctx)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "canceled")
+}
+
+func Test_GenerateRequest(t *testing.T) {
+	c := New("abc123")
+	c.AddPlugin(testPlugin())
+
+	request, err := c.GenerateRequest()
+	assert.Nil(t, err)
+	assert.Equal(t, 60, request.Plugins[0].DurationSec)
+	assert.Equal(t, 1.0, request.Plugins[0].Metrics["foo"])
+	assert.True(t, c.lastPollTime.IsZero())
+
+	// the next report covers only its own cycle
+	assert.Equal(t, time.Duration(0), c.Plugins[0].duration)
+	request, err = c.GenerateRequest()
+	assert.Nil(t, err)
+	assert.Equal(t, 60, request.Plugins[0].DurationSec)
+}
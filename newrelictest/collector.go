@@ -0,0 +1,322 @@
+/*
+Package newrelictest provides a fake platform API collector for testing plugins.
+
+	collector := newrelictest.NewCollector()
+	defer collector.Close()
+
+	client := newrelic.New("abc123")
+	collector.Configure(client)
+
+	// ... add plugins and trigger a report cycle ...
+
+	collector.AssertMetricCount(t, "My Plugin", "Requests[requests]", 1)
+*/
+package newrelictest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neocortical/newrelic"
+	"github.com/neocortical/newrelic/model"
+)
+
+// TestingT is the subset of testing.TB used by the assertion helpers
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// Response scripts the collector's reply to a single request
+type Response struct {
+	StatusCode int
+	Latency    time.Duration
+}
+
+// Payload records a single request received by the collector
+type Payload struct {
+	License    string
+	Request    model.Request
+	StatusCode int
+	Received   time.Time
+
+	// Err is set if the request failed validation
+	Err error
+}
+
+// Collector is a fake platform API collector backed by an httptest.Server. It
+// decodes and validates every request, records it and replies with scripted
+// responses, defaulting to 200 OK.
+type Collector struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	script   []Response
+	payloads []Payload
+}
+
+// NewCollector starts a new fake collector. Call Close when done.
+func NewCollector() *Collector {
+	c := &Collector{}
+	c.server = httptest.NewServer(http.HandlerFunc(c.serveHTTP))
+	return c
+}
+
+// URL returns the collector's endpoint
+func (c *Collector) URL() string {
+	return c.server.URL
+}
+
+// Close shuts the collector down
+func (c *Collector) Close() {
+	c.server.Close()
+}
+
+// Configure points client at the collector
+func (c *Collector) Configure(client *newrelic.Client) {
+	client.URL = c.server.URL
+	client.HTTPClient = c.server.Client()
+}
+
+// Script queues responses for the next requests, in order. Once the script
+// is exhausted the collector replies 200 OK with no latency.
+func (c *Collector) Script(responses ...Response) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.script = append(c.script, responses...)
+}
+
+// Payloads returns every request received, including invalid ones
+func (c *Collector) Payloads() []Payload {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Payload(nil), c.payloads...)
+}
+
+// Requests returns every valid request received
+func (c *Collector) Requests() (result []model.Request) {
+	for _, p := range c.Payloads() {
+		if p.Err == nil {
+			result = append(result, p.Request)
+		}
+	}
+	return result
+}
+
+// Reset discards recorded payloads and any remaining scripted responses
+func (c *Collector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.script = nil
+	c.payloads = nil
+}
+
+// Metric aggregates every value of a metric reported by a component across
+// all valid requests. The metric may be given as "Name[units]" or as the full
+// "Component/Name[units]" key.
+func (c *Collector) Metric(component, metric string) (result model.MetricValue, found bool) {
+	if !strings.HasPrefix(metric, "Component/") {
+		metric = "Component/" + metric
+	}
+
+	for _, r := range c.Requests() {
+		for _, p := range r.Plugins {
+			if p.Name != component {
+				continue
+			}
+			raw, ok := p.Metrics[metric]
+			if !ok {
+				continue
+			}
+			val, err := decodeMetricValue(raw)
+			if err != nil {
+				continue
+			}
+			result = merge(result, val)
+			found = true
+		}
+	}
+	return result, found
+}
+
+// AssertRequestCount asserts that the collector received count valid requests
+func (c *Collector) AssertRequestCount(t TestingT, count int) bool {
+	if n := len(c.Requests()); n != count {
+		t.Errorf("expected %d valid requests, got %d", count, n)
+		return false
+	}
+	return true
+}
+
+// AssertMetricCount asserts that a metric on a component was sampled count
+// times across all valid requests
+func (c *Collector) AssertMetricCount(t TestingT, component, metric string, count int) bool {
+	val, found := c.Metric(component, metric)
+	if !found {
+		t.Errorf("metric %s not reported on component %s", metric, component)
+		return false
+	}
+	if val.Count != count {
+		t.Errorf("expected metric %s on component %s to have count %d, got %d", metric, component, count, val.Count)
+		return false
+	}
+	return true
+}
+
+// AssertMetricTotal asserts the sum of all samples of a metric on a component
+// across all valid requests
+func (c *Collector) AssertMetricTotal(t TestingT, component, metric string, total float64) bool {
+	val, found := c.Metric(component, metric)
+	if !found {
+		t.Errorf("metric %s not reported on component %s", metric, component)
+		return false
+	}
+	if val.Total != total {
+		t.Errorf("expected metric %s on component %s to have total %v, got %v", metric, component, total, val.Total)
+		return false
+	}
+	return true
+}
+
+func (c *Collector) serveHTTP(rw http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	response := Response{StatusCode: http.StatusOK}
+	if len(c.script) > 0 {
+		response = c.script[0]
+		c.script = c.script[1:]
+	}
+	c.mu.Unlock()
+
+	payload := Payload{
+		License:  r.Header.Get("X-License-Key"),
+		Received: time.Now(),
+	}
+	payload.Err = decodeRequest(r, &payload.Request)
+
+	if response.Latency > 0 {
+		select {
+		case <-time.After(response.Latency):
+		case <-r.Context().Done():
+		}
+	}
+
+	payload.StatusCode = response.StatusCode
+	if payload.Err != nil {
+		payload.StatusCode = http.StatusBadRequest
+	}
+
+	c.mu.Lock()
+	c.payloads = append(c.payloads, payload)
+	c.mu.Unlock()
+
+	if payload.Err != nil {
+		http.Error(rw, payload.Err.Error(), payload.StatusCode)
+		return
+	}
+	rw.WriteHeader(payload.StatusCode)
+}
+
+func decodeRequest(r *http.Request, request *model.Request) error {
+	if r.Method != "POST" {
+		return fmt.Errorf("unexpected method %s", r.Method)
+	}
+	if r.Header.Get("X-License-Key") == "" {
+		return fmt.Errorf("missing X-License-Key header")
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+		return fmt.Errorf("unexpected Content-Type %q", ct)
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(request); err != nil {
+		return fmt.Errorf("error decoding request: %v", err)
+	}
+
+	return validateRequest(*request)
+}
+
+func validateRequest(request model.Request) error {
+	if request.Agent.Host == "" {
+		return fmt.Errorf("agent host is empty")
+	}
+	if request.Agent.Version == "" {
+		return fmt.Errorf("agent version is empty")
+	}
+	if len(request.Plugins) == 0 {
+		return fmt.Errorf("request has no components")
+	}
+
+	for i, p := range request.Plugins {
+		if p.Name == "" {
+			return fmt.Errorf("component %d has no name", i)
+		}
+		if p.GUID == "" {
+			return fmt.Errorf("component %s has no guid", p.Name)
+		}
+		if p.DurationSec <= 0 {
+			return fmt.Errorf("component %s has invalid duration %d", p.Name, p.DurationSec)
+		}
+		for k, v := range p.Metrics {
+			if !strings.HasPrefix(k, "Component/") || !strings.HasSuffix(k, "]") || !strings.Contains(k, "[") {
+				return fmt.Errorf("component %s has malformed metric key %q", p.Name, k)
+			}
+			if _, err := decodeMetricValue(v); err != nil {
+				return fmt.Errorf("component %s metric %s: %v", p.Name, k, err)
+			}
+		}
+	}
+	return nil
+}
+
+// decodeMetricValue normalizes a decoded JSON metric value, which is either a
+// bare number or an aggregate object
+func decodeMetricValue(raw interface{}) (result model.MetricValue, err error) {
+	switch v := raw.(type) {
+	case float64:
+		return model.MetricValue{Min: v, Max: v, Total: v, Count: 1, SumOfSquares: v * v}, nil
+	case model.MetricValue:
+		return v, nil
+	case map[string]interface{}:
+		for _, field := range []string{"min", "max", "total", "count", "sum_of_squares"} {
+			if _, ok := v[field].(float64); !ok {
+				return result, fmt.Errorf("aggregate is missing numeric %s", field)
+			}
+		}
+		if len(v) != 5 {
+			return result, fmt.Errorf("aggregate has unexpected fields")
+		}
+		result = model.MetricValue{
+			Min:          v["min"].(float64),
+			Max:          v["max"].(float64),
+			Total:        v["total"].(float64),
+			Count:        int(v["count"].(float64)),
+			SumOfSquares: v["sum_of_squares"].(float64),
+		}
+		if result.Count <= 0 {
+			return result, fmt.Errorf("aggregate has non-positive count %d", result.Count)
+		}
+		return result, nil
+	}
+	return result, fmt.Errorf("unexpected value %v", raw)
+}
+
+func merge(a, b model.MetricValue) model.MetricValue {
+	if a.Count == 0 {
+		return b
+	}
+	if b.Min < a.Min {
+		a.Min = b.Min
+	}
+	if b.Max > a.Max {
+		a.Max = b.Max
+	}
+	a.Total += b.Total
+	a.Count += b.Count
+	a.SumOfSquares += b.SumOfSquares
+	return a
+}
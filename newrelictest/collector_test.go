@@ -0,0 +1,134 @@
+package newrelictest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neocortical/newrelic"
+	"github.com/neocortical/newrelic/model"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingT struct {
+	errors []string
+}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func snapshot(metrics map[string]interface{}) []model.PluginSnapshot {
+	return []model.PluginSnapshot{{Name: "MyPlugin", GUID: "com.example.myplugin", DurationSec: 60, Metrics: metrics}}
+}
+
+func Test_Collector_recordsAndAggregates(t *testing.T) {
+	collector := NewCollector()
+	defer collector.Close()
+
+	client := newrelic.New("abc123")
+	collector.Configure(client)
+
+	assert.Nil(t, client.SendSnapshots(snapshot(map[string]interface{}{"Component/foo[bars]": 2.0})))
+	assert.Nil(t, client.SendSnapshots(snapshot(map[string]interface{}{
+		"Component/foo[bars]": model.MetricValue{Min: 1, Max: 5, Total: 6, Count: 2, SumOfSquares: 26},
+	})))
+
+	payloads := collector.Payloads()
+	assert.Equal(t, 2, len(payloads))
+	assert.Equal(t, "abc123", payloads[0].License)
+	assert.Equal(t, http.StatusOK, payloads[0].StatusCode)
+	assert.Nil(t, payloads[0].Err)
+
+	val, found := collector.Metric("MyPlugin", "foo[bars]")
+	assert.True(t, found)
+	assert.Equal(t, model.MetricValue{Min: 1, Max: 5, Total: 8, Count: 3, SumOfSquares: 30}, val)
+
+	assert.True(t, collector.AssertRequestCount(t, 2))
+	assert.True(t, collector.AssertMetricCount(t, "MyPlugin", "Component/foo[bars]", 3))
+	assert.True(t, collector.AssertMetricTotal(t, "MyPlugin", "foo[bars]", 8))
+
+	rt := &recordingT{}
+	assert.False(t, collector.AssertMetricCount(rt, "MyPlugin", "foo[bars]", 1))
+	assert.False(t, collector.AssertMetricCount(rt, "Other", "foo[bars]", 1))
+	assert.False(t, collector.AssertMetricTotal(rt, "MyPlugin", "foo[bars]", 1))
+	assert.False(t, collector.AssertRequestCount(rt, 1))
+	assert.Equal(t, 4, len(rt.errors))
+
+	collector.Reset()
+	assert.Equal(t, 0, len(collector.Payloads()))
+}
+
+func Test_Collector_scriptedResponses(t *testing.T) {
+	collector := NewCollector()
+	defer collector.Close()
+
+	client := newrelic.New("abc123")
+	collector.Configure(client)
+
+	collector.Script(
+		Response{StatusCode: http.StatusServiceUnavailable},
+		Response{StatusCode: http.StatusOK, Latency: 50 * time.Millisecond},
+	)
+
+	metrics := map[string]interface{}{"Component/foo[bars]": 1.0}
+	assert.NotNil(t, client.SendSnapshots(snapshot(metrics)))
+
+	start := time.Now()
+	assert.Nil(t, client.SendSnapshots(snapshot(metrics)))
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	// script exhausted
+	assert.Nil(t, client.SendSnapshots(snapshot(metrics)))
+
+	payloads := collector.Payloads()
+	assert.Equal(t, http.StatusServiceUnavailable, payloads[0].StatusCode)
+	assert.Equal(t, http.StatusOK, payloads[1].StatusCode)
+	assert.Equal(t, http.StatusOK, payloads[2].StatusCode)
+}
+
+func Test_Collector_rejectsInvalidRequests(t *testing.T) {
+	collector := NewCollector()
+	defer collector.Close()
+
+	client := newrelic.New("abc123")
+	collector.Configure(client)
+
+	invalid := [][]model.PluginSnapshot{
+		nil,
+		{{GUID: "com.example.myplugin", DurationSec: 60}},
+		{{Name: "MyPlugin", DurationSec: 60}},
+		{{Name: "MyPlugin", GUID: "com.example.myplugin"}},
+		snapshot(map[string]interface{}{"foo[bars]": 1.0}),
+		snapshot(map[string]interface{}{"Component/foo[bars]": "one"}),
+		snapshot(map[string]interface{}{"Component/foo[bars]": map[string]interface{}{"min": 1}}),
+		snapshot(map[string]interface{}{"Component/foo[bars]": model.MetricValue{}}),
+	}
+	for _, snapshots := range invalid {
+		assert.NotNil(t, client.SendSnapshots(snapshots))
+	}
+
+	payloads := collector.Payloads()
+	assert.Equal(t, len(invalid), len(payloads))
+	for _, p := range payloads {
+		assert.NotNil(t, p.Err)
+		assert.Equal(t, http.StatusBadRequest, p.StatusCode)
+	}
+	assert.Equal(t, 0, len(collector.Requests()))
+}
+
+func Test_Collector_rejectsBadHeaders(t *testing.T) {
+	collector := NewCollector()
+	defer collector.Close()
+
+	resp, err := http.Post(collector.URL(), "application/json", strings.NewReader("{}"))
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	payloads := collector.Payloads()
+	assert.Equal(t, 1, len(payloads))
+	assert.Contains(t, payloads[0].Err.Error(), "X-License-Key")
+}
@@ -0,0 +1,204 @@
+/*
+Package nrhttp records metrics for HTTP servers and clients into a plugin.
+
+	plugin := &newrelic.Plugin{Name: "My Service", GUID: "com.example.newrelic.myservice"}
+	client.AddPlugin(plugin)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /items/{id}", getItem)
+	http.ListenAndServe(":8080", nrhttp.NewMiddleware(plugin).Wrap(mux))
+
+Outbound calls are recorded per host by wrapping a client's transport:
+
+	httpClient := &http.Client{Transport: nrhttp.NewTransport(plugin, nil)}
+*/
+package nrhttp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/neocortical/newrelic"
+)
+
+// DefaultServerPrefix is the default prefix of server metric names
+const DefaultServerPrefix = "HTTP/Server"
+
+// RouteFunc names the route a request was served by. Metrics are grouped by
+// route, so it should return a small, fixed set of names such as URL patterns
+// rather than raw paths. It is called after the request has been served.
+type RouteFunc func(r *http.Request) string
+
+// PatternRoute names routes by the http.ServeMux pattern that matched the
+// request, e.g. "GET /items/{id}". Requests that matched no pattern are
+// grouped under OtherGroup.
+func PatternRoute(r *http.Request) string {
+	return r.Pattern
+}
+
+// Middleware records the throughput, latency, response sizes and status
+// classes of the requests it serves, per route. It reports to its plugin as a
+// newrelic.Source.
+type Middleware struct {
+	// Prefix is prepended to metric names. The default is
+	// DefaultServerPrefix.
+	Prefix string
+
+	// Route groups requests. The default is PatternRoute.
+	Route RouteFunc
+
+	// MaxRoutes limits how many routes are tracked. Requests to further
+	// routes are grouped under OtherGroup. The default is DefaultMaxGroups.
+	MaxRoutes int
+
+	stats stats
+}
+
+// NewMiddleware creates a middleware that reports to plugin. Set any options
+// before serving requests.
+func NewMiddleware(plugin *newrelic.Plugin) *Middleware {
+	m := &Middleware{Prefix: DefaultServerPrefix, Route: PatternRoute}
+	plugin.AddSource(m)
+	return m
+}
+
+// Wrap returns a handler that serves requests with next and records them
+func (m *Middleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: rw, status: http.StatusOK}
+		next.ServeHTTP(recorder.wrap(), r)
+		m.observe(r, recorder, time.Since(start))
+	})
+}
+
+func (m *Middleware) observe(r *http.Request, rec *responseRecorder, elapsed time.Duration) {
+	route := PatternRoute
+	if m.Route != nil {
+		route = m.Route
+	}
+
+	g := m.stats.group(route(r), m.MaxRoutes)
+	g.count("Requests", "requests", 1)
+	g.count(statusClass(rec.status), "responses", 1)
+	g.record("Latency", "ms", float64(elapsed)/float64(time.Millisecond))
+	g.record("Response Size", "bytes", float64(rec.size))
+}
+
+// PollSamples implements newrelic.Source
+func (m *Middleware) PollSamples() ([]newrelic.Sample, error) {
+	prefix := m.Prefix
+	if prefix == "" {
+		prefix = DefaultServerPrefix
+	}
+	return m.stats.samples(prefix), nil
+}
+
+// responseRecorder captures the status code and body size of a response
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	size        int64
+	wroteHeader bool
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if !rr.wroteHeader {
+		rr.status = status
+		rr.wroteHeader = true
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.wroteHeader = true
+	n, err := rr.ResponseWriter.Write(b)
+	rr.size += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+// wrap returns the recorder as a writer that implements http.Flusher,
+// http.Hijacker and io.ReaderFrom only where the underlying writer does, so
+// that handlers checking for them see the same writer as without middleware
+func (rr *responseRecorder) wrap() http.ResponseWriter {
+	_, canFlush := rr.ResponseWriter.(http.Flusher)
+	_, canHijack := rr.ResponseWriter.(http.Hijacker)
+	_, canReadFrom := rr.ResponseWriter.(io.ReaderFrom)
+	f, h, rf := recorderFlusher{rr}, recorderHijacker{rr}, recorderReaderFrom{rr}
+
+	switch {
+	case canFlush && canHijack && canReadFrom:
+		return struct {
+			*responseRecorder
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{rr, f, h, rf}
+	case canFlush && canHijack:
+		return struct {
+			*responseRecorder
+			http.Flusher
+			http.Hijacker
+		}{rr, f, h}
+	case canFlush && canReadFrom:
+		return struct {
+			*responseRecorder
+			http.Flusher
+			io.ReaderFrom
+		}{rr, f, rf}
+	case canHijack && canReadFrom:
+		return struct {
+			*responseRecorder
+			http.Hijacker
+			io.ReaderFrom
+		}{rr, h, rf}
+	case canFlush:
+		return struct {
+			*responseRecorder
+			http.Flusher
+		}{rr, f}
+	case canHijack:
+		return struct {
+			*responseRecorder
+			http.Hijacker
+		}{rr, h}
+	case canReadFrom:
+		return struct {
+			*responseRecorder
+			io.ReaderFrom
+		}{rr, rf}
+	}
+	return rr
+}
+
+type recorderFlusher struct{ rr *responseRecorder }
+
+func (f recorderFlusher) Flush() {
+	f.rr.wroteHeader = true
+	f.rr.ResponseWriter.(http.Flusher).Flush()
+}
+
+type recorderHijacker struct{ rr *responseRecorder }
+
+func (h recorderHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return h.rr.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+type recorderReaderFrom struct{ rr *responseRecorder }
+
+// ReadFrom counts the bytes copied to the underlying writer, which may send a
+// file without passing it through Write
+func (rf recorderReaderFrom) ReadFrom(src io.Reader) (int64, error) {
+	rf.rr.wroteHeader = true
+	n, err := rf.rr.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+	rf.rr.size += n
+	return n, err
+}
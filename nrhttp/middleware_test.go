@@ -0,0 +1,130 @@
+package nrhttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/neocortical/newrelic"
+	"github.com/neocortical/newrelic/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func testClient() (*newrelic.Client, *newrelic.Plugin) {
+	client := newrelic.New("abc123")
+	plugin := &newrelic.Plugin{Name: "MyService", GUID: "com.example.myservice"}
+	client.AddPlugin(plugin)
+	return client, plugin
+}
+
+func Test_Middleware(t *testing.T) {
+	client, plugin := testClient()
+	m := NewMiddleware(plugin)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /items/{id}", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("item"))
+	})
+	mux.HandleFunc("POST /items", func(rw http.ResponseWriter, r *http.Request) {
+		http.Error(rw, "nope", http.StatusBadRequest)
+	})
+	handler := m.Wrap(mux)
+
+	for _, path := range []string{"/items/1", "/items/2"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/items", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+
+	request, err := client.GenerateRequest()
+	assert.Nil(t, err)
+	metrics := request.Plugins[0].Metrics
+
+	assert.Equal(t, 2.0, metrics["Component/HTTP/Server/GET /items/{id}/Requests[requests]"])
+	assert.Equal(t, 2.0, metrics["Component/HTTP/Server/GET /items/{id}/Status/2xx[responses]"])
+	size := metrics["Component/HTTP/Server/GET /items/{id}/Response Size[bytes]"].(model.MetricValue)
+	assert.Equal(t, 2, size.Count)
+	assert.Equal(t, 8.0, size.Total)
+	assert.Equal(t, 2, metrics["Component/HTTP/Server/GET /items/{id}/Latency[ms]"].(model.MetricValue).Count)
+
+	assert.Equal(t, 1.0, metrics["Component/HTTP/Server/POST /items/Status/4xx[responses]"])
+	assert.Equal(t, 1.0, metrics["Component/HTTP/Server/Other/Status/4xx[responses]"])
+}
+
+func Test_Middleware_routeLimit(t *testing.T) {
+	client, plugin := testClient()
+	m := NewMiddleware(plugin)
+	m.Prefix = "Web"
+	m.MaxRoutes = 1
+	m.Route = func(r *http.Request) string { return r.URL.Path }
+
+	handler := m.Wrap(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	for _, path := range []string{"/a", "/b", "/c", "/a"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	request, err := client.GenerateRequest()
+	assert.Nil(t, err)
+	metrics := request.Plugins[0].Metrics
+	assert.Equal(t, 2.0, metrics["Component/Web/a/Requests[requests]"])
+	assert.Equal(t, 2.0, metrics["Component/Web/Other/Requests[requests]"])
+
+	// counters keep reporting zero once seen. the request was not sent, so
+	// the new samples add to the previous ones.
+	request, err = client.GenerateRequest()
+	assert.Nil(t, err)
+	metrics = request.Plugins[0].Metrics
+	assert.Equal(t, model.MetricValue{Min: 0, Max: 2, Total: 2, Count: 2, SumOfSquares: 4}, metrics["Component/Web/a/Requests[requests]"])
+	assert.Equal(t, 2, metrics["Component/Web/a/Latency[ms]"].(model.MetricValue).Count)
+}
+
+func Test_Middleware_optionalInterfaces(t *testing.T) {
+	client, plugin := testClient()
+	m := NewMiddleware(plugin)
+
+	var flusher, hijacker, readerFrom bool
+	handler := m.Wrap(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		_, flusher = rw.(http.Flusher)
+		_, hijacker = rw.(http.Hijacker)
+		_, readerFrom = rw.(io.ReaderFrom)
+		if r.URL.Path == "/hijack" {
+			conn, buf, err := rw.(http.Hijacker).Hijack()
+			assert.Nil(t, err)
+			buf.WriteString("HTTP/1.1 204 No Content\r\nConnection: close\r\n\r\n")
+			buf.Flush()
+			conn.Close()
+			return
+		}
+		io.Copy(rw, strings.NewReader("hello"))
+	}))
+
+	// only what the underlying writer implements is exposed
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, []bool{true, false, false}, []bool{flusher, hijacker, readerFrom})
+	handler.ServeHTTP(struct{ http.ResponseWriter }{httptest.NewRecorder()}, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, []bool{false, false, false}, []bool{flusher, hijacker, readerFrom})
+
+	svr := httptest.NewServer(handler)
+	defer svr.Close()
+	resp, err := http.Get(svr.URL + "/copy")
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "hello", string(body))
+	assert.Equal(t, []bool{true, true, true}, []bool{flusher, hijacker, readerFrom})
+
+	resp, err = http.Get(svr.URL + "/hijack")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	request, err := client.GenerateRequest()
+	assert.Nil(t, err)
+	size := request.Plugins[0].Metrics["Component/HTTP/Server/Other/Response Size[bytes]"].(model.MetricValue)
+	assert.Equal(t, 4, size.Count)
+	assert.Equal(t, 15.0, size.Total)
+}
@@ -0,0 +1,130 @@
+package nrhttp
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/neocortical/newrelic"
+)
+
+const (
+	// DefaultMaxGroups is the default limit on distinct routes or hosts
+	DefaultMaxGroups = 100
+
+	// OtherGroup collects requests beyond the group limit
+	OtherGroup = "Other"
+)
+
+// stats accumulates counters and recorders per group (route or host)
+type stats struct {
+	mu     sync.Mutex
+	groups map[string]*group
+}
+
+type group struct {
+	mu        sync.Mutex
+	counters  map[string]*newrelic.Counter
+	recorders map[string]*newrelic.Recorder
+}
+
+// group returns the named group, creating it if there is room
+func (s *stats) group(name string, max int) *group {
+	if max <= 0 {
+		max = DefaultMaxGroups
+	}
+	if name == "" {
+		name = OtherGroup
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.groups == nil {
+		s.groups = make(map[string]*group)
+	}
+	if g, ok := s.groups[name]; ok {
+		return g
+	}
+	if len(s.groups) >= max {
+		name = OtherGroup
+		if g, ok := s.groups[name]; ok {
+			return g
+		}
+	}
+
+	g := &group{
+		counters:  make(map[string]*newrelic.Counter),
+		recorders: make(map[string]*newrelic.Recorder),
+	}
+	s.groups[name] = g
+	return g
+}
+
+// count adds n to the named counter
+func (g *group) count(name, units string, n float64) {
+	g.mu.Lock()
+	c, ok := g.counters[name]
+	if !ok {
+		c = newrelic.NewCounter(name, units)
+		g.counters[name] = c
+	}
+	g.mu.Unlock()
+	c.Add(n)
+}
+
+// record adds a value to the named recorder
+func (g *group) record(name, units string, val float64) {
+	g.mu.Lock()
+	r, ok := g.recorders[name]
+	if !ok {
+		r = newrelic.NewRecorder(name, units)
+		g.recorders[name] = r
+	}
+	g.mu.Unlock()
+	r.Record(val)
+}
+
+// samples reports every counter seen so far, including those that are zero
+// this cycle, and every recorder that has values. Metric names are
+// prefix/group/name.
+func (s *stats) samples(prefix string) (result []newrelic.Sample) {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.groups))
+	groups := make([]*group, 0, len(s.groups))
+	for name, g := range s.groups {
+		names = append(names, name)
+		groups = append(groups, g)
+	}
+	s.mu.Unlock()
+
+	for i, g := range groups {
+		g.mu.Lock()
+		for _, c := range g.counters {
+			val, _ := c.Poll()
+			result = append(result, newrelic.Sample{
+				Name:  prefix + "/" + names[i] + "/" + c.Name(),
+				Units: c.Units(),
+				Value: val,
+				Kind:  newrelic.KindCount,
+			})
+		}
+		for _, r := range g.recorders {
+			if agg, _ := r.PollAggregate(); agg.Count > 0 {
+				result = append(result, newrelic.Sample{
+					Name:      prefix + "/" + names[i] + "/" + r.Name(),
+					Units:     r.Units(),
+					Aggregate: agg,
+				})
+			}
+		}
+		g.mu.Unlock()
+	}
+
+	sort.Slice(result, func(a, b int) bool { return result[a].Name < result[b].Name })
+	return result
+}
+
+// statusClass returns e.g. "Status/2xx" for a status code
+func statusClass(code int) string {
+	return "Status/" + strconv.Itoa(code/100) + "xx"
+}
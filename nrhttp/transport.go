@@ -0,0 +1,85 @@
+package nrhttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/neocortical/newrelic"
+)
+
+// DefaultClientPrefix is the default prefix of outbound call metric names
+const DefaultClientPrefix = "HTTP/Client"
+
+// Transport is an http.RoundTripper that records the calls, latency, errors,
+// timeouts and response status classes of outbound requests, per host. It
+// reports to its plugin as a newrelic.Source.
+type Transport struct {
+	// Base performs the requests. The default is http.DefaultTransport.
+	Base http.RoundTripper
+
+	// Prefix is prepended to metric names. The default is
+	// DefaultClientPrefix.
+	Prefix string
+
+	// MaxHosts limits how many hosts are tracked. Calls to further hosts are
+	// grouped under OtherGroup. The default is DefaultMaxGroups.
+	MaxHosts int
+
+	stats stats
+}
+
+// NewTransport creates a transport that performs requests with base and
+// reports to plugin. Set any options before making requests.
+func NewTransport(plugin *newrelic.Plugin, base http.RoundTripper) *Transport {
+	t := &Transport{Base: base, Prefix: DefaultClientPrefix}
+	plugin.AddSource(t)
+	return t
+}
+
+// RoundTrip implements http.RoundTripper. Latency is measured until the
+// response headers are received.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	start := time.Now()
+	resp, err := base.RoundTrip(r)
+	elapsed := time.Since(start)
+
+	g := t.stats.group(r.URL.Host, t.MaxHosts)
+	g.count("Calls", "calls", 1)
+	g.record("Latency", "ms", float64(elapsed)/float64(time.Millisecond))
+	if err != nil {
+		g.count("Errors", "errors", 1)
+		if isTimeout(r, err) {
+			g.count("Timeouts", "timeouts", 1)
+		}
+		return resp, err
+	}
+	g.count(statusClass(resp.StatusCode), "responses", 1)
+	return resp, nil
+}
+
+// PollSamples implements newrelic.Source
+func (t *Transport) PollSamples() ([]newrelic.Sample, error) {
+	prefix := t.Prefix
+	if prefix == "" {
+		prefix = DefaultClientPrefix
+	}
+	return t.stats.samples(prefix), nil
+}
+
+// isTimeout reports whether a call failed by timing out. A client's timeout
+// may surface as a canceled request, so the request's deadline is checked too.
+func isTimeout(r *http.Request, err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,63 @@
+package nrhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/neocortical/newrelic/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Transport(t *testing.T) {
+	testSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		case "/fail":
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer testSvr.Close()
+	host := mustHost(t, testSvr.URL)
+
+	client, plugin := testClient()
+	httpClient := &http.Client{Transport: NewTransport(plugin, nil)}
+
+	for _, path := range []string{"/ok", "/ok", "/fail"} {
+		resp, err := httpClient.Get(testSvr.URL + path)
+		assert.Nil(t, err)
+		resp.Body.Close()
+	}
+
+	httpClient.Timeout = 50 * time.Millisecond
+	_, err := httpClient.Get(testSvr.URL + "/slow")
+	assert.NotNil(t, err)
+
+	_, err = httpClient.Get("http://127.0.0.1:1/refused")
+	assert.NotNil(t, err)
+
+	request, err := client.GenerateRequest()
+	assert.Nil(t, err)
+	metrics := request.Plugins[0].Metrics
+
+	prefix := "Component/HTTP/Client/" + host + "/"
+	assert.Equal(t, 4.0, metrics[prefix+"Calls[calls]"])
+	assert.Equal(t, 2.0, metrics[prefix+"Status/2xx[responses]"])
+	assert.Equal(t, 1.0, metrics[prefix+"Status/5xx[responses]"])
+	assert.Equal(t, 1.0, metrics[prefix+"Errors[errors]"])
+	assert.Equal(t, 1.0, metrics[prefix+"Timeouts[timeouts]"])
+	assert.Equal(t, 4, metrics[prefix+"Latency[ms]"].(model.MetricValue).Count)
+
+	assert.Equal(t, 1.0, metrics["Component/HTTP/Client/127.0.0.1:1/Errors[errors]"])
+	_, found := metrics["Component/HTTP/Client/127.0.0.1:1/Timeouts[timeouts]"]
+	assert.False(t, found)
+}
+
+func mustHost(t *testing.T, rawurl string) string {
+	u, err := url.Parse(rawurl)
+	assert.Nil(t, err)
+	return u.Host
+}
@@ -0,0 +1,158 @@
+package newrelic
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+// Option configures a Client created with NewClient
+type Option func(c *Client) error
+
+// WithHost reports host as the agent's host instead of the system host name
+func WithHost(host string) Option {
+	return func(c *Client) error {
+		if host == "" {
+			return fmt.Errorf("host is empty")
+		}
+		c.agent.Host = host
+		return nil
+	}
+}
+
+// WithHostFromEnv reports the value of an environment variable as the agent's
+// host, such as a node name set by a container orchestrator. The system host
+// name is used if the variable is empty.
+func WithHostFromEnv(name string) Option {
+	return func(c *Client) error {
+		if host := os.Getenv(name); host != "" {
+			c.agent.Host = host
+		}
+		return nil
+	}
+}
+
+// WithVersion reports version as the agent's version, such as the version of
+// the application reporting the plugins
+func WithVersion(version string) Option {
+	return func(c *Client) error {
+		if version == "" {
+			return fmt.Errorf("version is empty")
+		}
+		c.agent.Version = version
+		return nil
+	}
+}
+
+// WithPID reports pid as the agent's process ID
+func WithPID(pid int) Option {
+	return func(c *Client) error {
+		if pid <= 0 {
+			return fmt.Errorf("pid %d is not positive", pid)
+		}
+		c.agent.PID = pid
+		return nil
+	}
+}
+
+// WithCABundle trusts the PEM certificates in the file at path, such as the CA
+// of a TLS-inspecting proxy, in addition to the system's and those already
+// trusted by the transport, e.g. from an earlier WithCABundle
+func WithCABundle(path string) Option {
+	return func(c *Client) error {
+		pem, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading CA bundle: %v", err)
+		}
+
+		t, err := c.ownTransport()
+		if err != nil {
+			return err
+		}
+		// the transport's pool may be shared with the caller's, so add to a
+		// copy
+		var pool *x509.CertPool
+		if t.TLSClientConfig.RootCAs != nil {
+			pool = t.TLSClientConfig.RootCAs.Clone()
+		} else if pool, err = x509.SystemCertPool(); err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("CA bundle %s has no certificates", path)
+		}
+		t.TLSClientConfig.RootCAs = pool
+		return nil
+	}
+}
+
+// WithClientCertificate presents the certificate and key in PEM files, e.g. to
+// authenticate to an internal relay with mutual TLS
+func WithClientCertificate(certFile, keyFile string) Option {
+	return func(c *Client) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("error loading client certificate: %v", err)
+		}
+
+		t, err := c.ownTransport()
+		if err != nil {
+			return err
+		}
+		t.TLSClientConfig.Certificates = append(t.TLSClientConfig.Certificates, cert)
+		return nil
+	}
+}
+
+// WithMinTLSVersion refuses connections below version, such as
+// tls.VersionTLS12
+func WithMinTLSVersion(version uint16) Option {
+	return func(c *Client) error {
+		if version < tls.VersionTLS10 || version > tls.VersionTLS13 {
+			return fmt.Errorf("unknown TLS version %#x", version)
+		}
+
+		t, err := c.ownTransport()
+		if err != nil {
+			return err
+		}
+		t.TLSClientConfig.MinVersion = version
+		return nil
+	}
+}
+
+// WithProxyFromEnvironment sends requests through the proxy named by the
+// HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables
+func WithProxyFromEnvironment() Option {
+	return func(c *Client) error {
+		t, err := c.ownTransport()
+		if err != nil {
+			return err
+		}
+		t.Proxy = http.ProxyFromEnvironment
+		return nil
+	}
+}
+
+// ownTransport returns a transport that belongs to the client alone. The
+// first time, the HTTP client shared by default is replaced with a copy, so
+// that other clients are unaffected.
+func (c *Client) ownTransport() (*http.Transport, error) {
+	if c.HTTPClient == netClient {
+		c.HTTPClient = &http.Client{
+			Timeout:   netClient.Timeout,
+			Transport: netTransport.Clone(),
+		}
+	}
+
+	t, ok := c.HTTPClient.Transport.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("HTTP client transport %T can't be configured", c.HTTPClient.Transport)
+	}
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	return t, nil
+}
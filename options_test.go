@@ -0,0 +1,154 @@
+package newrelic
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/neocortical/newrelic/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewClient(t *testing.T) {
+	c, err := NewClient("abc123")
+	assert.Nil(t, err)
+	host, _ := os.Hostname()
+	assert.Equal(t, model.Agent{Host: host, Version: agentVersion, PID: os.Getpid()}, c.Agent())
+
+	c, err = NewClient("abc123", WithHost("node-1"), WithVersion("2.3.4"), WithPID(42))
+	assert.Nil(t, err)
+	assert.Equal(t, model.Agent{Host: "node-1", Version: "2.3.4", PID: 42}, c.Agent())
+
+	request, err := c.GenerateRequest()
+	assert.Nil(t, err)
+	assert.Equal(t, c.Agent(), request.Agent)
+}
+
+func Test_NewClient_invalid(t *testing.T) {
+	c, err := NewClient("abc123", WithHost(""), WithVersion(""), WithPID(0))
+	assert.Nil(t, c)
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, len(err.(CompositeError)))
+}
+
+func Test_WithHostFromEnv(t *testing.T) {
+	os.Setenv("TEST_NODE_NAME", "node-2")
+	defer os.Unsetenv("TEST_NODE_NAME")
+
+	c, err := NewClient("abc123", WithHostFromEnv("TEST_NODE_NAME"))
+	assert.Nil(t, err)
+	assert.Equal(t, "node-2", c.Agent().Host)
+
+	c, err = NewClient("abc123", WithHostFromEnv("TEST_UNSET_NODE_NAME"))
+	assert.Nil(t, err)
+	host, _ := os.Hostname()
+	assert.Equal(t, host, c.Agent().Host)
+}
+
+// writeCertificate writes a self-signed certificate and its key as PEM files
+func writeCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	certFile = filepath.Join(dir, "client.pem")
+	keyFile = filepath.Join(dir, "client-key.pem")
+	assert.Nil(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func Test_NewClient_tls(t *testing.T) {
+	var clientCerts int
+	testSvr := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		clientCerts = len(r.TLS.PeerCertificates)
+	}))
+	testSvr.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	testSvr.StartTLS()
+	defer testSvr.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	assert.Nil(t, ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: testSvr.Certificate().Raw}), 0600))
+	certFile, keyFile := writeCertificate(t, dir)
+
+	c, err := NewClient("abc123",
+		WithCABundle(caFile),
+		WithClientCertificate(certFile, keyFile),
+		WithMinTLSVersion(tls.VersionTLS12),
+		WithProxyFromEnvironment())
+	assert.Nil(t, err)
+	c.URL = testSvr.URL
+	c.AddPlugin(testPlugin())
+
+	assert.Nil(t, c.ReportOnce(context.Background()))
+	assert.Equal(t, 1, clientCerts)
+
+	transport := c.HTTPClient.Transport.(*http.Transport)
+	assert.Equal(t, uint16(tls.VersionTLS12), transport.TLSClientConfig.MinVersion)
+	assert.NotNil(t, transport.Proxy)
+	assert.Equal(t, netClient.Timeout, c.HTTPClient.Timeout)
+
+	// the shared client is untouched
+	assert.True(t, netClient.Transport == netTransport)
+	assert.Nil(t, netTransport.TLSClientConfig)
+	assert.Nil(t, netTransport.Proxy)
+	assert.True(t, New("abc123").HTTPClient == netClient)
+
+	// without the CA bundle the server isn't trusted
+	c, err = NewClient("abc123", WithMinTLSVersion(tls.VersionTLS12))
+	assert.Nil(t, err)
+	c.URL = testSvr.URL
+	assert.NotNil(t, c.ReportOnce(context.Background()))
+
+	// a second bundle adds to the first
+	otherDir := filepath.Join(dir, "other")
+	assert.Nil(t, os.Mkdir(otherDir, 0700))
+	otherCA, _ := writeCertificate(t, otherDir)
+	c, err = NewClient("abc123", WithCABundle(caFile), WithCABundle(otherCA))
+	assert.Nil(t, err)
+	c.URL = testSvr.URL
+	c.AddPlugin(testPlugin())
+	assert.Nil(t, c.ReportOnce(context.Background()))
+}
+
+func Test_NewClient_tlsInvalid(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.pem")
+	assert.Nil(t, ioutil.WriteFile(empty, nil, 0600))
+
+	_, err := NewClient("abc123",
+		WithCABundle(filepath.Join(dir, "missing.pem")),
+		WithCABundle(empty),
+		WithClientCertificate(empty, empty),
+		WithMinTLSVersion(0x0200))
+	assert.NotNil(t, err)
+	assert.Equal(t, 4, len(err.(CompositeError)))
+
+	c := New("abc123")
+	c.HTTPClient = &http.Client{}
+	assert.NotNil(t, WithProxyFromEnvironment()(c))
+}
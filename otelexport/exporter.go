@@ -0,0 +1,243 @@
+/*
+Package otelexport provides an OpenTelemetry metric exporter that reports
+through a newrelic.Client, so instrumentation written against the OpenTelemetry
+SDK can keep feeding plugin dashboards.
+
+Each instrumentation scope becomes a component named after the scope and each
+data point becomes a metric whose name is the instrument name followed by its
+attributes as key/value name segments:
+
+	client := newrelic.New("abc123")
+	exporter := otelexport.New(client, "com.example.newrelic.myapp")
+	reader := metric.NewPeriodicReader(exporter, metric.WithInterval(newrelic.DefaultPollInterval))
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+*/
+package otelexport
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/neocortical/newrelic"
+	"github.com/neocortical/newrelic/model"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// Exporter converts OpenTelemetry metric data into plugin snapshots and sends
+// them through a newrelic.Client
+type Exporter struct {
+	// GUID identifies the plugin that every exported component reports under
+	GUID string
+
+	// ComponentName maps an instrumentation scope to a component name. The
+	// scope name is used when nil.
+	ComponentName func(scope instrumentation.Scope) string
+
+	client     *newrelic.Client
+	mu         sync.Mutex
+	lastExport time.Time
+	shutdown   bool
+}
+
+var _ metric.Exporter = (*Exporter)(nil)
+
+// New creates an Exporter that reports through client under the given GUID
+func New(client *newrelic.Client, guid string) *Exporter {
+	return &Exporter{
+		GUID:   guid,
+		client: client,
+	}
+}
+
+// Temporality implements metric.Exporter. The plugin API expects values for
+// the reporting interval only, so delta temporality is used for everything
+// except up/down counters, whose current level is more useful than the change.
+func (e *Exporter) Temporality(kind metric.InstrumentKind) metricdata.Temporality {
+	switch kind {
+	case metric.InstrumentKindUpDownCounter, metric.InstrumentKindObservableUpDownCounter:
+		return metricdata.CumulativeTemporality
+	}
+	return metricdata.DeltaTemporality
+}
+
+// Aggregation implements metric.Exporter using the SDK defaults
+func (e *Exporter) Aggregation(kind metric.InstrumentKind) metric.Aggregation {
+	return metric.DefaultAggregationSelector(kind)
+}
+
+// Export implements metric.Exporter
+func (e *Exporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.shutdown {
+		return fmt.Errorf("otelexport: exporter is shut down")
+	}
+
+	now := time.Now()
+	duration := e.client.PollInterval
+	if !e.lastExport.IsZero() {
+		duration = now.Sub(e.lastExport)
+	}
+
+	snapshots := e.convert(rm, duration)
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	// the reader has already reset its delta data, so the next export covers
+	// only its own interval even if this one fails
+	e.lastExport = now
+	return e.client.SendSnapshots(snapshots)
+}
+
+// ForceFlush implements metric.Exporter. Export is synchronous so there is
+// nothing buffered to flush.
+func (e *Exporter) ForceFlush(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Shutdown implements metric.Exporter
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	e.shutdown = true
+	e.mu.Unlock()
+	return ctx.Err()
+}
+
+func (e *Exporter) convert(rm *metricdata.ResourceMetrics, duration time.Duration) (result []model.PluginSnapshot) {
+	durationSec := int(duration / time.Second)
+	if durationSec < 1 {
+		durationSec = 1
+	}
+
+	for _, sm := range rm.ScopeMetrics {
+		snapshot := model.PluginSnapshot{
+			Name:        e.componentName(sm.Scope),
+			GUID:        e.GUID,
+			DurationSec: durationSec,
+			Metrics:     make(map[string]interface{}),
+		}
+
+		for _, m := range sm.Metrics {
+			addMetric(snapshot.Metrics, m)
+		}
+
+		if len(snapshot.Metrics) > 0 {
+			result = append(result, snapshot)
+		}
+	}
+
+	return result
+}
+
+func (e *Exporter) componentName(scope instrumentation.Scope) string {
+	if e.ComponentName != nil {
+		return e.ComponentName(scope)
+	}
+	return scope.Name
+}
+
+func addMetric(metrics map[string]interface{}, m metricdata.Metrics) {
+	units := newrelic.SanitizeUnits(m.Unit)
+
+	switch data := m.Data.(type) {
+	case metricdata.Gauge[int64]:
+		for _, dp := range data.DataPoints {
+			setValue(metrics, metricKey(m.Name, units, dp.Attributes), float64(dp.Value))
+		}
+	case metricdata.Gauge[float64]:
+		for _, dp := range data.DataPoints {
+			setValue(metrics, metricKey(m.Name, units, dp.Attributes), dp.Value)
+		}
+	case metricdata.Sum[int64]:
+		for _, dp := range data.DataPoints {
+			setValue(metrics, metricKey(m.Name, units, dp.Attributes), float64(dp.Value))
+		}
+	case metricdata.Sum[float64]:
+		for _, dp := range data.DataPoints {
+			setValue(metrics, metricKey(m.Name, units, dp.Attributes), dp.Value)
+		}
+	case metricdata.Histogram[int64]:
+		for _, dp := range data.DataPoints {
+			if dp.Count == 0 {
+				continue
+			}
+			min, minOK := dp.Min.Value()
+			max, maxOK := dp.Max.Value()
+			setValue(metrics, metricKey(m.Name, units, dp.Attributes), histogramValue(
+				float64(dp.Sum), dp.Count, float64(min), minOK, float64(max), maxOK))
+		}
+	case metricdata.Histogram[float64]:
+		for _, dp := range data.DataPoints {
+			if dp.Count == 0 {
+				continue
+			}
+			min, minOK := dp.Min.Value()
+			max, maxOK := dp.Max.Value()
+			setValue(metrics, metricKey(m.Name, units, dp.Attributes), histogramValue(
+				dp.Sum, dp.Count, min, minOK, max, maxOK))
+		}
+	default:
+		newrelic.Log(newrelic.LogDebug, "otelexport: skipping unsupported aggregation %T for %s", m.Data, m.Name)
+	}
+}
+
+// setValue adds a data point's value under key. Non-finite values are skipped,
+// as a single one would make the whole request unencodable.
+func setValue(metrics map[string]interface{}, key string, value interface{}) {
+	var fields []float64
+	switch v := value.(type) {
+	case float64:
+		fields = []float64{v}
+	case model.MetricValue:
+		fields = []float64{v.Min, v.Max, v.Total, v.SumOfSquares}
+	}
+	for _, f := range fields {
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			newrelic.Log(newrelic.LogError, "ERROR: otelexport: skipping %s with non-finite value %v", key, value)
+			return
+		}
+	}
+	metrics[key] = value
+}
+
+// histogramValue builds an aggregate from a histogram data point. Histograms
+// do not record a sum of squares, so it is estimated as if every sample were
+// the mean; charts of averages are exact but standard deviation reads as 0.
+func histogramValue(sum float64, count uint64, min float64, minOK bool, max float64, maxOK bool) model.MetricValue {
+	mean := sum / float64(count)
+	if !minOK {
+		min = mean
+	}
+	if !maxOK {
+		max = mean
+	}
+	return model.MetricValue{
+		Min:          min,
+		Max:          max,
+		Total:        sum,
+		Count:        int(count),
+		SumOfSquares: mean * sum,
+	}
+}
+
+// metricKey appends each attribute to the instrument name as a key/value pair
+// of name segments, e.g. http.server.duration/method/GET[ms]
+func metricKey(name, units string, attrs attribute.Set) string {
+	iter := attrs.Iter()
+	for iter.Next() {
+		kv := iter.Attribute()
+		name += "/" + string(kv.Key) + "/" + kv.Value.Emit()
+	}
+	return "Component/" + newrelic.SanitizeMetricName(name) + "[" + units + "]"
+}
@@ -0,0 +1,203 @@
+package otelexport
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neocortical/newrelic"
+	"github.com/neocortical/newrelic/model"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	otelmetric "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func captureClient(status int, requests *[]model.Request) *http.Client {
+	return &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		var req model.Request
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &req)
+		*requests = append(*requests, req)
+		return &http.Response{StatusCode: status, Body: ioutil.NopCloser(strings.NewReader("")), Request: r}, nil
+	})}
+}
+
+func Test_convert(t *testing.T) {
+	e := New(newrelic.New("abc123"), "com.example.otel")
+
+	rm := &metricdata.ResourceMetrics{
+		ScopeMetrics: []metricdata.ScopeMetrics{
+			{
+				Scope: instrumentation.Scope{Name: "myapp/http"},
+				Metrics: []metricdata.Metrics{
+					{
+						Name: "requests",
+						Unit: "{request}",
+						Data: metricdata.Sum[int64]{
+							Temporality: metricdata.DeltaTemporality,
+							IsMonotonic: true,
+							DataPoints: []metricdata.DataPoint[int64]{
+								{Attributes: attribute.NewSet(attribute.String("method", "GET"), attribute.Int("code", 200)), Value: 12},
+							},
+						},
+					},
+					{
+						Name: "queue.depth",
+						Data: metricdata.Gauge[float64]{
+							DataPoints: []metricdata.DataPoint[float64]{{Value: 3.5}},
+						},
+					},
+					{
+						Name: "latency",
+						Unit: "ms",
+						Data: metricdata.Histogram[float64]{
+							Temporality: metricdata.DeltaTemporality,
+							DataPoints: []metricdata.HistogramDataPoint[float64]{
+								{
+									Count: 4,
+									Sum:   20,
+									Min:   metricdata.NewExtrema(2.0),
+									Max:   metricdata.NewExtrema(9.0),
+								},
+								{Attributes: attribute.NewSet(attribute.String("route", "empty"))},
+								{Attributes: attribute.NewSet(attribute.String("route", "/items/[id]")), Count: 1, Sum: 3},
+							},
+						},
+					},
+				},
+			},
+			{Scope: instrumentation.Scope{Name: "unused"}},
+		},
+	}
+
+	snapshots := e.convert(rm, 30*time.Second)
+	assert.Equal(t, 1, len(snapshots))
+
+	s := snapshots[0]
+	assert.Equal(t, "myapp/http", s.Name)
+	assert.Equal(t, "com.example.otel", s.GUID)
+	assert.Equal(t, 30, s.DurationSec)
+	assert.Equal(t, 4, len(s.Metrics))
+	assert.Equal(t, 12.0, s.Metrics["Component/requests/code/200/method/GET[{request}]"])
+	assert.Equal(t, 3.5, s.Metrics["Component/queue.depth[value]"])
+	assert.Equal(t, model.MetricValue{Min: 2, Max: 9, Total: 20, Count: 4, SumOfSquares: 100}, s.Metrics["Component/latency[ms]"])
+	assert.Equal(t, model.MetricValue{Min: 3, Max: 3, Total: 3, Count: 1, SumOfSquares: 9}, s.Metrics["Component/latency/route/items/(id)[ms]"])
+}
+
+func Test_convert_componentNameAndMinimumDuration(t *testing.T) {
+	e := New(newrelic.New("abc123"), "com.example.otel")
+	e.ComponentName = func(scope instrumentation.Scope) string { return "Scope " + scope.Version }
+
+	rm := &metricdata.ResourceMetrics{
+		ScopeMetrics: []metricdata.ScopeMetrics{{
+			Scope: instrumentation.Scope{Name: "lib", Version: "1.2"},
+			Metrics: []metricdata.Metrics{{
+				Name: "n",
+				Unit: "things",
+				Data: metricdata.Gauge[int64]{DataPoints: []metricdata.DataPoint[int64]{{Value: 7}}},
+			}},
+		}},
+	}
+
+	snapshots := e.convert(rm, 10*time.Millisecond)
+	assert.Equal(t, "Scope 1.2", snapshots[0].Name)
+	assert.Equal(t, 1, snapshots[0].DurationSec)
+	assert.Equal(t, 7.0, snapshots[0].Metrics["Component/n[things]"])
+}
+
+func Test_Temporality(t *testing.T) {
+	e := New(newrelic.New("abc123"), "com.example.otel")
+	assert.Equal(t, metricdata.DeltaTemporality, e.Temporality(metric.InstrumentKindCounter))
+	assert.Equal(t, metricdata.DeltaTemporality, e.Temporality(metric.InstrumentKindHistogram))
+	assert.Equal(t, metricdata.CumulativeTemporality, e.Temporality(metric.InstrumentKindUpDownCounter))
+}
+
+func Test_Export_viaReader(t *testing.T) {
+	var requests []model.Request
+	client := newrelic.New("abc123")
+	client.HTTPClient = captureClient(http.StatusOK, &requests)
+
+	e := New(client, "com.example.otel")
+	reader := metric.NewPeriodicReader(e, metric.WithInterval(time.Hour))
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	counter, err := provider.Meter("myapp").Int64Counter("jobs", otelmetric.WithUnit("jobs"))
+	assert.Nil(t, err)
+	counter.Add(context.Background(), 3)
+	counter.Add(context.Background(), 2)
+
+	assert.Nil(t, provider.ForceFlush(context.Background()))
+	assert.Equal(t, 1, len(requests))
+	assert.Equal(t, "myapp", requests[0].Plugins[0].Name)
+	assert.Equal(t, 5.0, requests[0].Plugins[0].Metrics["Component/jobs[jobs]"])
+
+	assert.Nil(t, provider.Shutdown(context.Background()))
+	assert.NotNil(t, e.Export(context.Background(), &metricdata.ResourceMetrics{}))
+}
+
+func Test_Export_errorResponse(t *testing.T) {
+	var requests []model.Request
+	client := newrelic.New("abc123")
+	client.HTTPClient = captureClient(http.StatusForbidden, &requests)
+
+	e := New(client, "com.example.otel")
+	err := e.Export(context.Background(), &metricdata.ResourceMetrics{
+		ScopeMetrics: []metricdata.ScopeMetrics{{
+			Scope: instrumentation.Scope{Name: "lib"},
+			Metrics: []metricdata.Metrics{{
+				Name: "n",
+				Data: metricdata.Gauge[int64]{DataPoints: []metricdata.DataPoint[int64]{{Value: 1}}},
+			}},
+		}},
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, len(requests))
+
+	// the data is gone either way, so the next export covers only its own
+	// interval
+	assert.False(t, e.lastExport.IsZero())
+}
+
+func Test_convert_nonFinite(t *testing.T) {
+	e := New(newrelic.New("abc123"), "com.example.otel")
+
+	rm := &metricdata.ResourceMetrics{
+		ScopeMetrics: []metricdata.ScopeMetrics{{
+			Scope: instrumentation.Scope{Name: "lib"},
+			Metrics: []metricdata.Metrics{
+				{
+					Name: "ratio",
+					Data: metricdata.Gauge[float64]{DataPoints: []metricdata.DataPoint[float64]{
+						{Attributes: attribute.NewSet(attribute.String("pool", "a")), Value: math.NaN()},
+						{Attributes: attribute.NewSet(attribute.String("pool", "b")), Value: 0.5},
+					}},
+				},
+				{
+					Name: "total",
+					Data: metricdata.Sum[float64]{DataPoints: []metricdata.DataPoint[float64]{{Value: math.Inf(1)}}},
+				},
+				{
+					Name: "latency",
+					Data: metricdata.Histogram[float64]{DataPoints: []metricdata.HistogramDataPoint[float64]{
+						{Count: 2, Sum: math.Inf(1)},
+					}},
+				},
+			},
+		}},
+	}
+
+	snapshots := e.convert(rm, time.Minute)
+	assert.Equal(t, map[string]interface{}{"Component/ratio/pool/b[value]": 0.5}, snapshots[0].Metrics)
+}
@@ -1,51 +1,326 @@
 package newrelic
 
 import (
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/neocortical/newrelic/model"
 )
 
+// ConflictPolicy decides what AddMetric does with a metric whose key (name and
+// units) is already in use on the plugin
+type ConflictPolicy int
+
+const (
+	// ConflictReject makes AddMetric return an error
+	ConflictReject ConflictPolicy = iota
+	// ConflictReplace replaces the existing metric and discards its state
+	ConflictReplace
+	// ConflictMerge polls both metrics and reports their samples together as
+	// a single aggregate
+	ConflictMerge
+)
+
+// StalePolicy decides what a plugin reports for a metric whose poll failed
+type StalePolicy int
+
+const (
+	// StaleOmit leaves errored metrics out of the report
+	StaleOmit StalePolicy = iota
+	// StaleLastValue reports an errored metric's last good value: any samples
+	// not yet sent, or else the value most recently reported, as long as the
+	// last successful poll is no older than Plugin.MaxStaleness
+	StaleLastValue
+)
+
 // Plugin encapsulates all data and state for a plug-in (AKA Component)
 type Plugin struct {
 	Name string
 	GUID string
 
+	// SanitizeNames makes AddMetric repair invalid metric names and units
+	// instead of rejecting them. See SanitizeMetricName.
+	SanitizeNames bool
+
+	// OnConflict decides how AddMetric handles duplicate metric keys. The
+	// default is ConflictReject. It also applies to sources reporting samples
+	// with the same key: the error is reported and the first source's samples
+	// kept, the last source's samples are reported, or all are merged.
+	OnConflict ConflictPolicy
+
+	// Stale decides what is reported for metrics whose poll failed. The
+	// default is StaleOmit.
+	Stale StalePolicy
+
+	// MaxStaleness limits how long StaleLastValue keeps reporting a metric
+	// after its last successful poll. Zero means no limit.
+	MaxStaleness time.Duration
+
+	// MetricPrefix is prepended to every metric name, after the client's
+	// MetricPrefix. It may refer to $variables, which are looked up in Labels,
+	// then the client's Labels, then "hostname", then the environment, e.g.
+	// "Cluster/${CLUSTER_NAME}/Queue".
+	MetricPrefix string
+
+	// Labels are user-defined variables for MetricPrefix
+	Labels map[string]string
+
+	// mu guards metrics and sources, so that they can be added while the
+	// plugin is reporting. It is held while polling, so they must not be
+	// added from within a poll.
+	mu sync.Mutex
+
 	duration time.Duration
 	metrics  map[string]*statefulMetric
+	sources  []*sourceState
+
+	// dimensional holds the output of the last snapshot for the Metric API,
+	// covering dimDuration: the samples of each key not yet delivered there
+	dimensional map[string]dimensionalSample
+	dimDuration time.Duration
 }
 
-// AddMetric adds a new metric definition to the plugin/component
-func (p *Plugin) AddMetric(metric Metric) {
+// AddMetric adds a new metric definition to the plugin/component. Metrics with
+// invalid names or units are rejected unless SanitizeNames is set. It is safe
+// to add metrics while the plugin is reporting.
+func (p *Plugin) AddMetric(metric Metric) error {
+	key := generateMetricKey(metric)
+	if p.SanitizeNames {
+		if SanitizeMetricName(metric.Name()) == "" {
+			return fmt.Errorf("metric name %q is empty after sanitizing", metric.Name())
+		}
+		key = sanitizeMetricKey(metric.Name(), metric.Units())
+	} else if err := ValidateMetric(metric); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	if p.metrics == nil {
 		p.metrics = make(map[string]*statefulMetric)
 	}
-	p.metrics[generateMetricKey(metric)] = &statefulMetric{metric: metric}
+
+	if existing, ok := p.metrics[key]; ok {
+		switch p.OnConflict {
+		case ConflictReplace:
+			Log(LogInfo, "replacing metric %s on plugin %s", key, p.Name)
+		case ConflictMerge:
+			existing.metric = mergeMetrics(existing.metric, metric)
+			return nil
+		default:
+			return fmt.Errorf("plugin %s already has a metric %s", p.Name, key)
+		}
+	}
+
+	p.metrics[key] = &statefulMetric{metric: metric}
+	return nil
 }
 
 func (p *Plugin) generatePluginSnapshot(duration time.Duration) (result model.PluginSnapshot, err CompositeError) {
+	return p.snapshot(duration, naming{})
+}
+
+func (p *Plugin) snapshot(duration time.Duration, n naming) (result model.PluginSnapshot, err CompositeError) {
+	prefix := joinPrefix(n.prefix, expandTemplate(p.MetricPrefix, n.hostname, p.Labels, n.labels))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	p.duration += duration
+	p.dimDuration += duration
 	result.Name = p.Name
 	result.GUID = p.GUID
 	result.DurationSec = int(p.duration / time.Second)
 	result.Metrics = make(map[string]interface{})
+	p.dimensional = make(map[string]dimensionalSample)
 
 	for k, m := range p.metrics {
+		setClock(m.metric, n.clock)
 		value, cerr := m.generateMetricSnapshot()
+		err = err.Accumulate(cerr)
+		err = err.Accumulate(p.record(&result, prefixMetricKey(k, prefix), m, value, cerr, duration))
+	}
+
+	// sources are recorded in the order they were added, which decides how
+	// keys reported by more than one are resolved
+	for _, src := range p.sources {
+		keys, serr := src.poll(p)
+		err = append(err, serr...)
 
-		// we are tolerant of request generation errors. metrics that error out are not sent
-		if cerr != nil {
+		// if the whole source failed, its metrics are handled as if each
+		// poll had failed
+		if serr != nil && len(keys) == 0 {
+			for k, m := range src.metrics {
+				err = err.Accumulate(p.record(&result, prefixMetricKey(k, prefix), m, nil, serr, duration))
+			}
+			continue
+		}
+		polled := make(map[string]bool)
+		for _, k := range keys {
+			m := src.metrics[k]
+			setClock(m.metric, n.clock)
+			value, cerr := m.generateMetricSnapshot()
 			err = err.Accumulate(cerr)
+			err = err.Accumulate(p.record(&result, prefixMetricKey(k, prefix), m, value, cerr, duration))
+			polled[k] = true
+		}
+
+		// metrics missing from this poll still report samples that have not
+		// been sent yet
+		for k, m := range src.metrics {
+			if !polled[k] && (m.state.Count > 0 || m.dimState.Count > 0) {
+				err = err.Accumulate(p.record(&result, prefixMetricKey(k, prefix), m, m.snapshotValue(), nil, duration))
+			}
 		}
-		result.Metrics[k] = value
 	}
 
-	return result, nil
+	return result, err
+}
+
+// record adds a polled metric value to the snapshot under key. We are tolerant
+// of request generation errors: metrics that error out are not sent unless they
+// returned samples along with the error or the stale policy provides a previous
+// value. A key already recorded from another
+// source is resolved by OnConflict, and the conflict is returned as an error
+// if it is rejected.
+func (p *Plugin) record(result *model.PluginSnapshot, key string, m *statefulMetric, value interface{}, err error, duration time.Duration) error {
+	if err != nil {
+		atomic.AddInt64(&m.errors, 1)
+		m.staleFor += duration
+		if value == nil {
+			value = p.staleValue(m)
+		}
+	} else if value != nil {
+		m.lastGood = value
+		m.staleFor = 0
+	}
+	conflict := p.recordDimensional(key, m, err)
+
+	if value != nil {
+		if existing, ok := result.Metrics[key]; ok {
+			conflict = true
+			value = p.resolveConflict(existing, value)
+		}
+		result.Metrics[key] = value
+	}
+
+	if !conflict {
+		return nil
+	}
+	switch p.OnConflict {
+	case ConflictReplace:
+		Log(LogInfo, "replacing samples of %s from another source on plugin %s", key, p.Name)
+	case ConflictReject:
+		return fmt.Errorf("plugin %s has more than one source of metric %s", p.Name, key)
+	}
+	return nil
+}
+
+// resolveConflict returns the value reported for a key that was already
+// recorded as existing
+func (p *Plugin) resolveConflict(existing, value interface{}) interface{} {
+	switch p.OnConflict {
+	case ConflictReplace:
+		return value
+	case ConflictMerge:
+		return mergeState(aggregateValue(existing), aggregateValue(value))
+	}
+	return existing
+}
+
+// aggregateValue turns a reported value back into an aggregate
+func aggregateValue(value interface{}) model.MetricValue {
+	if v, ok := value.(model.MetricValue); ok {
+		return v
+	}
+	return updateState(model.MetricValue{}, value.(float64))
+}
+
+// recordDimensional adds a metric's samples not yet delivered to the Metric API
+// under key. An errored gauge with none falls back to the stale policy. It
+// reports whether the key was already recorded, resolving it like record.
+func (p *Plugin) recordDimensional(key string, m *statefulMetric, err error) bool {
+	typ := dimensionalType(m.metric)
+	value := m.dimState
+	if value.Count == 0 && err != nil && typ == model.MetricTypeGauge {
+		if v, ok := p.staleValue(m).(float64); ok {
+			value = updateState(value, v)
+		}
+	}
+	if value.Count == 0 {
+		return false
+	}
+
+	existing, ok := p.dimensional[key]
+	switch {
+	case !ok, p.OnConflict == ConflictReplace:
+		p.dimensional[key] = dimensionalSample{value: value, typ: typ}
+	case p.OnConflict == ConflictMerge:
+		existing.value = mergeState(existing.value, value)
+		p.dimensional[key] = existing
+	}
+	return ok
+}
+
+func (p *Plugin) staleValue(m *statefulMetric) interface{} {
+	if p.Stale != StaleLastValue {
+		return nil
+	}
+	if m.state.Count > 0 {
+		return m.snapshotValue()
+	}
+	if p.MaxStaleness > 0 && m.staleFor > p.MaxStaleness {
+		return nil
+	}
+	return m.lastGood
+}
+
+// ErrorCounts returns the number of failed polls of each metric, keyed by
+// metric key. Metrics that have never failed are omitted.
+func (p *Plugin) ErrorCounts() map[string]int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := make(map[string]int64)
+	p.eachMetric(func(k string, m *statefulMetric) {
+		if n := atomic.LoadInt64(&m.errors); n > 0 {
+			result[k] += n
+		}
+	})
+	return result
 }
 
 func (p *Plugin) clearState() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	p.duration = 0
-	for _, m := range p.metrics {
+	p.eachMetric(func(_ string, m *statefulMetric) {
 		m.clearState()
+	})
+}
+
+func (p *Plugin) clearDimensionalState() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.dimDuration = 0
+	p.eachMetric(func(_ string, m *statefulMetric) {
+		m.clearDimState()
+	})
+}
+
+// eachMetric calls fn with each of the plugin's metrics and those seen from its
+// sources, which may share keys. The caller must hold mu.
+func (p *Plugin) eachMetric(fn func(key string, m *statefulMetric)) {
+	for k, m := range p.metrics {
+		fn(k, m)
+	}
+	for _, src := range p.sources {
+		for k, m := range src.metrics {
+			fn(k, m)
+		}
 	}
 }
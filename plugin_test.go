@@ -1,8 +1,11 @@
 package newrelic
 
 import (
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/neocortical/newrelic/model"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -17,3 +20,149 @@ func Test_AddMetric(t *testing.T) {
 	assert.Equal(t, 1, len(c.metrics))
 	assert.Equal(t, "bar", c.metrics[generateMetricKey(m)].metric.Name())
 }
+
+func Test_AddMetric_validation(t *testing.T) {
+	c := &Plugin{Name: "foo"}
+
+	err := c.AddMetric(NewMetric("/bar[1]", "ducks", func() (float64, error) { return 1, nil }))
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(c.metrics))
+
+	c.SanitizeNames = true
+	err = c.AddMetric(NewMetric("/bar[1]", "", func() (float64, error) { return 1, nil }))
+	assert.Nil(t, err)
+	assert.Equal(t, "/bar[1]", c.metrics["Component/bar(1)[value]"].metric.Name())
+
+	err = c.AddMetric(NewMetric("//", "ducks", func() (float64, error) { return 1, nil }))
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, len(c.metrics))
+}
+
+func Test_AddMetric_conflictPolicy(t *testing.T) {
+	one := NewMetric("bar", "ducks", func() (float64, error) { return 1, nil })
+	two := NewMetric("bar", "ducks", func() (float64, error) { return 2, nil })
+	key := generateMetricKey(one)
+
+	c := &Plugin{Name: "foo"}
+	assert.Nil(t, c.AddMetric(one))
+	assert.NotNil(t, c.AddMetric(two))
+	assert.Equal(t, one, c.metrics[key].metric)
+
+	// metrics with the same name but different units do not conflict
+	assert.Nil(t, c.AddMetric(NewMetric("bar", "geese", func() (float64, error) { return 1, nil })))
+
+	c.OnConflict = ConflictReplace
+	c.metrics[key].generateMetricSnapshot()
+	assert.Nil(t, c.AddMetric(two))
+	assert.Equal(t, two, c.metrics[key].metric)
+	assert.Equal(t, 0, c.metrics[key].state.Count)
+
+	c = &Plugin{Name: "foo", OnConflict: ConflictMerge}
+	assert.Nil(t, c.AddMetric(one))
+	assert.Nil(t, c.AddMetric(two))
+	assert.Nil(t, c.AddMetric(NewRecorder("bar", "ducks")))
+	c.metrics[key].metric.(*mergedMetric).metrics[2].(*Recorder).Record(6)
+
+	snapshot, err := c.generatePluginSnapshot(time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, model.MetricValue{Min: 1, Max: 6, Total: 9, Count: 3, SumOfSquares: 41}, snapshot.Metrics[key])
+}
+
+func Test_mergedMetric_errors(t *testing.T) {
+	mm := mergeMetrics(
+		NewMetric("bar", "ducks", func() (float64, error) { return 1, nil }),
+		NewMetric("bar", "ducks", func() (float64, error) { return 0, errors.New("derp") }),
+	)
+	assert.Equal(t, "bar", mm.Name())
+	assert.Equal(t, "ducks", mm.Units())
+
+	_, err := mm.Poll()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "derp")
+
+	// the samples of the metrics that succeed are kept, and the error names
+	// the metric once
+	counter := NewCounter("c", "events")
+	p := &Plugin{Name: "foo", GUID: "com.example.foo", OnConflict: ConflictMerge}
+	p.AddMetric(counter)
+	p.AddMetric(NewMetric("c", "events", func() (float64, error) { return 0, errors.New("boom") }))
+	counter.Add(5)
+	snapshot, cerr := p.generatePluginSnapshot(time.Minute)
+	assert.Equal(t, 1, len(cerr))
+	assert.Equal(t, "c error: boom", cerr[0].Error())
+	assert.Equal(t, 5.0, snapshot.Metrics["Component/c[events]"])
+
+	ok := mergeMetrics(
+		NewMetric("bar", "ducks", func() (float64, error) { return 1, nil }),
+		NewMetric("bar", "ducks", func() (float64, error) { return 2, nil }),
+	)
+	val, err := ok.Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, 3.0, val)
+}
+
+func Test_generatePluginSnapshot_errors(t *testing.T) {
+	fail := false
+	p := &Plugin{Name: "foo", GUID: "com.example.foo"}
+	p.AddMetric(NewMetric("good", "bars", func() (float64, error) { return 1, nil }))
+	p.AddMetric(NewMetric("flaky", "bars", func() (float64, error) {
+		if fail {
+			return 0, errors.New("derp")
+		}
+		return 2, nil
+	}))
+
+	snapshot, err := p.generatePluginSnapshot(time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 2.0, snapshot.Metrics["Component/flaky[bars]"])
+	p.clearState()
+
+	// errored metrics are omitted by default and their errors propagate
+	fail = true
+	snapshot, err = p.generatePluginSnapshot(time.Minute)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, len(err))
+	assert.Contains(t, err.Error(), "derp")
+	assert.Equal(t, map[string]interface{}{"Component/good[bars]": 1.0}, snapshot.Metrics)
+	assert.Equal(t, map[string]int64{"Component/flaky[bars]": 1}, p.ErrorCounts())
+}
+
+func Test_generatePluginSnapshot_staleLastValue(t *testing.T) {
+	fail := false
+	val := 2.0
+	p := &Plugin{Name: "foo", GUID: "com.example.foo", Stale: StaleLastValue, MaxStaleness: 2 * time.Minute}
+	p.AddMetric(NewMetric("flaky", "bars", func() (float64, error) {
+		if fail {
+			return 0, errors.New("derp")
+		}
+		return val, nil
+	}))
+	key := "Component/flaky[bars]"
+
+	snapshot, _ := p.generatePluginSnapshot(time.Minute)
+	assert.Equal(t, 2.0, snapshot.Metrics[key])
+
+	// send failed, so unsent samples are reported along with the error
+	fail = true
+	snapshot, err := p.generatePluginSnapshot(time.Minute)
+	assert.NotNil(t, err)
+	assert.Equal(t, 2.0, snapshot.Metrics[key])
+
+	fail = false
+	val = 4
+	snapshot, _ = p.generatePluginSnapshot(time.Minute)
+	assert.Equal(t, model.MetricValue{Min: 2, Max: 4, Total: 6, Count: 2, SumOfSquares: 20}, snapshot.Metrics[key])
+	p.clearState()
+
+	// sent successfully, the last reported value is repeated until it is too old
+	fail = true
+	for i := 0; i < 2; i++ {
+		snapshot, _ = p.generatePluginSnapshot(time.Minute)
+		assert.Equal(t, model.MetricValue{Min: 2, Max: 4, Total: 6, Count: 2, SumOfSquares: 20}, snapshot.Metrics[key])
+		p.clearState()
+	}
+	snapshot, _ = p.generatePluginSnapshot(time.Minute)
+	_, found := snapshot.Metrics[key]
+	assert.False(t, found)
+	assert.Equal(t, map[string]int64{key: 4}, p.ErrorCounts())
+}
@@ -0,0 +1,231 @@
+/*
+Package command polls metrics from external commands, so that plugins can be
+written in any language. Each poll runs the command and parses its standard
+output, which is either JSON or lines of the form "name[units] value":
+
+	Queue/Depth[messages] 42
+	Queue/Processed[messages] 1337
+
+Blank lines and lines starting with # are ignored. JSON output is either an
+object mapping metric keys to values:
+
+	{"Queue/Depth[messages]": 42, "Queue/Processed[messages]": 1337}
+
+or an array of samples, which may also set the metric kind:
+
+	[{"name": "Queue/Processed", "units": "messages", "value": 1337, "kind": "rate"}]
+*/
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neocortical/newrelic"
+)
+
+const (
+	// DefaultTimeout is the default limit on how long a command may run
+	DefaultTimeout = 10 * time.Second
+
+	// DefaultMaxOutput is the default limit on a command's output in bytes
+	DefaultMaxOutput = 1 << 20
+
+	// maxStderr limits how much of a failed command's stderr is reported
+	maxStderr = 512
+)
+
+// Source is a newrelic.Source that runs a command on every poll
+type Source struct {
+	// Path and Args are the command to run, as for exec.Command
+	Path string
+	Args []string
+
+	// Dir and Env are passed on to the command as in exec.Cmd
+	Dir string
+	Env []string
+
+	// Timeout kills the command if it runs longer. The default is
+	// DefaultTimeout.
+	Timeout time.Duration
+
+	// MaxOutput fails the poll if the command writes more bytes than this to
+	// stdout. The default is DefaultMaxOutput.
+	MaxOutput int
+
+	// Kind is the metric kind of samples that don't set their own, e.g.
+	// newrelic.KindRate for commands that print cumulative counters
+	Kind string
+}
+
+// New creates a source that runs the named program with the given arguments
+func New(path string, args ...string) *Source {
+	return &Source{Path: path, Args: args}
+}
+
+// PollSamples runs the command and parses its output. Lines that fail to parse
+// are reported in the error, but the remaining samples are still returned.
+func (s *Source) PollSamples() ([]newrelic.Sample, error) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	maxOutput := s.MaxOutput
+	if maxOutput <= 0 {
+		maxOutput = DefaultMaxOutput
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, s.Path, s.Args...)
+	cmd.Dir = s.Dir
+	cmd.Env = s.Env
+	stdout := &limitedBuffer{max: maxOutput}
+	stderr := &limitedBuffer{max: maxStderr}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	// don't wait on grandchildren that hold the pipes open after a timeout
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return nil, fmt.Errorf("command %s timed out after %v", s.Path, timeout)
+	case stdout.overflow:
+		return nil, fmt.Errorf("command %s wrote more than %d bytes", s.Path, maxOutput)
+	case err != nil:
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("command %s failed: %v: %s", s.Path, err, msg)
+		}
+		return nil, fmt.Errorf("command %s failed: %v", s.Path, err)
+	}
+
+	samples, err := Parse(stdout.Bytes())
+	for i := range samples {
+		if samples[i].Kind == "" {
+			samples[i].Kind = s.Kind
+		}
+	}
+	if err != nil {
+		return samples, fmt.Errorf("command %s: %v", s.Path, err)
+	}
+	return samples, nil
+}
+
+// Parse parses command output in either of the supported formats. Lines that
+// fail to parse are reported together in the error.
+func Parse(output []byte) ([]newrelic.Sample, error) {
+	trimmed := bytes.TrimSpace(output)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return parseJSON(trimmed)
+	}
+	return parseLines(string(output))
+}
+
+func parseJSON(output []byte) (result []newrelic.Sample, err error) {
+	if output[0] == '{' {
+		var values map[string]float64
+		if err = json.Unmarshal(output, &values); err != nil {
+			return nil, fmt.Errorf("error parsing JSON output: %v", err)
+		}
+		var cerr newrelic.CompositeError
+		for key, value := range values {
+			name, units, kerr := splitKey(key)
+			if kerr != nil {
+				cerr = cerr.Accumulate(kerr)
+				continue
+			}
+			result = append(result, newrelic.Sample{Name: name, Units: units, Value: value})
+		}
+		if cerr != nil {
+			return result, cerr
+		}
+		return result, nil
+	}
+
+	var samples []struct {
+		Name  string  `json:"name"`
+		Units string  `json:"units"`
+		Value float64 `json:"value"`
+		Kind  string  `json:"kind"`
+	}
+	if err = json.Unmarshal(output, &samples); err != nil {
+		return nil, fmt.Errorf("error parsing JSON output: %v", err)
+	}
+	for _, s := range samples {
+		result = append(result, newrelic.Sample{Name: s.Name, Units: s.Units, Value: s.Value, Kind: s.Kind})
+	}
+	return result, nil
+}
+
+func parseLines(output string) (result []newrelic.Sample, err error) {
+	var cerr newrelic.CompositeError
+	for i, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// the key may contain spaces, the value may not
+		sep := strings.LastIndexAny(line, " \t")
+		if sep < 0 {
+			cerr = cerr.Accumulate(fmt.Errorf("line %d: expected \"name[units] value\"", i+1))
+			continue
+		}
+		name, units, kerr := splitKey(strings.TrimSpace(line[:sep]))
+		if kerr != nil {
+			cerr = cerr.Accumulate(fmt.Errorf("line %d: %v", i+1, kerr))
+			continue
+		}
+		value, perr := strconv.ParseFloat(line[sep+1:], 64)
+		if perr != nil {
+			cerr = cerr.Accumulate(fmt.Errorf("line %d: invalid value %q", i+1, line[sep+1:]))
+			continue
+		}
+		result = append(result, newrelic.Sample{Name: name, Units: units, Value: value})
+	}
+
+	if cerr != nil {
+		return result, cerr
+	}
+	return result, nil
+}
+
+// splitKey splits a name[units] key
+func splitKey(key string) (name, units string, err error) {
+	open := strings.LastIndex(key, "[")
+	if open <= 0 || !strings.HasSuffix(key, "]") {
+		return "", "", fmt.Errorf("metric key %q is not of the form name[units]", key)
+	}
+	return key[:open], key[open+1 : len(key)-1], nil
+}
+
+// limitedBuffer keeps up to max bytes and records whether more were written.
+// The buffer is not embedded so that io.Copy can't bypass Write via ReadFrom.
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	max      int
+	overflow bool
+}
+
+func (lb *limitedBuffer) Write(p []byte) (int, error) {
+	if room := lb.max - lb.buf.Len(); len(p) > room {
+		lb.overflow = true
+		if room > 0 {
+			lb.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return lb.buf.Write(p)
+}
+
+func (lb *limitedBuffer) Bytes() []byte  { return lb.buf.Bytes() }
+func (lb *limitedBuffer) String() string { return lb.buf.String() }
@@ -0,0 +1,69 @@
+package command
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neocortical/newrelic"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Parse_lines(t *testing.T) {
+	samples, err := Parse([]byte("# queue stats\nQueue/Depth[messages] 42\n\nQueue Wait[ms]\t1.5\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, []newrelic.Sample{
+		{Name: "Queue/Depth", Units: "messages", Value: 42},
+		{Name: "Queue Wait", Units: "ms", Value: 1.5},
+	}, samples)
+
+	samples, err = Parse([]byte("Depth 42\nDepth[messages] many\nnothing\nGood[things] 1\n"))
+	assert.Equal(t, 3, len(err.(newrelic.CompositeError)))
+	assert.Equal(t, []newrelic.Sample{{Name: "Good", Units: "things", Value: 1}}, samples)
+}
+
+func Test_Parse_json(t *testing.T) {
+	samples, err := Parse([]byte(` {"Queue/Depth[messages]": 42}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []newrelic.Sample{{Name: "Queue/Depth", Units: "messages", Value: 42}}, samples)
+
+	samples, err = Parse([]byte(`[{"name": "Processed", "units": "messages", "value": 7, "kind": "rate"}]`))
+	assert.Nil(t, err)
+	assert.Equal(t, []newrelic.Sample{{Name: "Processed", Units: "messages", Value: 7, Kind: newrelic.KindRate}}, samples)
+
+	_, err = Parse([]byte(`{"Depth[messages]": "42"}`))
+	assert.NotNil(t, err)
+	_, err = Parse([]byte(`{"Depth": 42}`))
+	assert.NotNil(t, err)
+}
+
+func Test_Source_PollSamples(t *testing.T) {
+	src := New("sh", "-c", "echo 'Processed[messages] 10'")
+	src.Kind = newrelic.KindDelta
+	samples, err := src.PollSamples()
+	assert.Nil(t, err)
+	assert.Equal(t, []newrelic.Sample{{Name: "Processed", Units: "messages", Value: 10, Kind: newrelic.KindDelta}}, samples)
+}
+
+func Test_Source_PollSamples_failures(t *testing.T) {
+	_, err := New("sh", "-c", "echo oops >&2; exit 3").PollSamples()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "oops")
+
+	src := New("sleep", "5")
+	src.Timeout = 50 * time.Millisecond
+	start := time.Now()
+	_, err = src.PollSamples()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+	assert.True(t, time.Since(start) < 2*time.Second)
+
+	src = New("sh", "-c", "echo '"+strings.Repeat("a", 100)+"'")
+	src.MaxOutput = 10
+	_, err = src.PollSamples()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "more than 10 bytes")
+
+	_, err = New("/nonexistent/command").PollSamples()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,176 @@
+/*
+Package haproxy reports per-frontend and per-backend statistics from an
+HAProxy stats page in CSV format.
+
+	plugin := &newrelic.Plugin{Name: "Load Balancer", GUID: "com.example.newrelic.lb"}
+	plugin.AddSource(haproxy.New("http://localhost:8404/stats;csv"))
+
+Backend metrics are named HAProxy/<backend>/..., and frontend metrics
+HAProxy/<frontend>/Frontend/..., so that a listen section reporting both
+doesn't collide. Individual servers are not reported. Current sessions,
+queues, active servers, response times and status are gauges; session,
+byte, error, denial and response counters are per-second rates.
+*/
+package haproxy
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/neocortical/newrelic"
+	"github.com/neocortical/newrelic/plugins/internal/scrape"
+)
+
+// DefaultPrefix is the default prefix of metric names
+const DefaultPrefix = "HAProxy"
+
+const (
+	frontend = "FRONTEND"
+	backend  = "BACKEND"
+)
+
+type field struct {
+	column string
+	name   string
+	units  string
+	kind   string
+}
+
+// common fields are reported for both frontends and backends
+var common = []field{
+	{"scur", "Sessions/Current", "sessions", newrelic.KindGauge},
+	{"stot", "Sessions/Total", "sessions/second", newrelic.KindRate},
+	{"bin", "Bytes/In", "bytes/second", newrelic.KindRate},
+	{"bout", "Bytes/Out", "bytes/second", newrelic.KindRate},
+	{"dreq", "Denied/Requests", "requests/second", newrelic.KindRate},
+	{"dresp", "Denied/Responses", "responses/second", newrelic.KindRate},
+	{"hrsp_1xx", "Responses/1xx", "responses/second", newrelic.KindRate},
+	{"hrsp_2xx", "Responses/2xx", "responses/second", newrelic.KindRate},
+	{"hrsp_3xx", "Responses/3xx", "responses/second", newrelic.KindRate},
+	{"hrsp_4xx", "Responses/4xx", "responses/second", newrelic.KindRate},
+	{"hrsp_5xx", "Responses/5xx", "responses/second", newrelic.KindRate},
+}
+
+var frontendFields = []field{
+	{"ereq", "Errors/Request", "errors/second", newrelic.KindRate},
+	{"req_rate", "Requests/Rate", "requests/second", newrelic.KindGauge},
+}
+
+var backendFields = []field{
+	{"qcur", "Queue/Current", "requests", newrelic.KindGauge},
+	{"econ", "Errors/Connection", "errors/second", newrelic.KindRate},
+	{"eresp", "Errors/Response", "errors/second", newrelic.KindRate},
+	{"act", "Servers/Active", "servers", newrelic.KindGauge},
+	{"bck", "Servers/Backup", "servers", newrelic.KindGauge},
+	{"qtime", "Time/Queue", "ms", newrelic.KindGauge},
+	{"ctime", "Time/Connect", "ms", newrelic.KindGauge},
+	{"rtime", "Time/Response", "ms", newrelic.KindGauge},
+	{"ttime", "Time/Total", "ms", newrelic.KindGauge},
+}
+
+// Source is a newrelic.Source that scrapes an HAProxy CSV stats page
+type Source struct {
+	// URL is the stats page, usually ending in ;csv
+	URL string
+
+	// Username and Password are sent with basic auth if Username is set
+	Username string
+	Password string
+
+	// Client fetches the page. A client with scrape.DefaultTimeout is used
+	// when nil.
+	Client *http.Client
+
+	// Prefix is prepended to metric names. The default is DefaultPrefix.
+	Prefix string
+}
+
+// New creates a source scraping the CSV stats page at url
+func New(url string) *Source {
+	return &Source{URL: url, Prefix: DefaultPrefix}
+}
+
+// PollSamples implements newrelic.Source
+func (s *Source) PollSamples() ([]newrelic.Sample, error) {
+	body, err := scrape.Get(s.Client, s.URL, s.Username, s.Password)
+	if err != nil {
+		return nil, fmt.Errorf("haproxy %s: %v", s.URL, err)
+	}
+	rows, err := ParseCSV(body)
+	if err != nil {
+		return nil, fmt.Errorf("haproxy %s: %v", s.URL, err)
+	}
+
+	prefix := s.Prefix
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+
+	var result []newrelic.Sample
+	for _, row := range rows {
+		var base string
+		var fields []field
+		switch row["svname"] {
+		case frontend:
+			base = prefix + "/" + row["pxname"] + "/Frontend/"
+			fields = append(common, frontendFields...)
+		case backend:
+			base = prefix + "/" + row["pxname"] + "/"
+			fields = append(common, backendFields...)
+		default:
+			continue
+		}
+
+		for _, f := range fields {
+			v, err := strconv.ParseFloat(row[f.column], 64)
+			if err != nil {
+				continue
+			}
+			result = append(result, newrelic.Sample{Name: base + f.name, Units: f.units, Value: v, Kind: f.kind})
+		}
+		if status, ok := row["status"]; ok {
+			result = append(result, newrelic.Sample{Name: base + "Up", Units: "boolean", Value: up(status)})
+		}
+	}
+	return result, nil
+}
+
+// up is 1 for frontends that are open and backends that are up
+func up(status string) float64 {
+	if status == "OPEN" || strings.HasPrefix(status, "UP") {
+		return 1
+	}
+	return 0
+}
+
+// ParseCSV parses a CSV stats page into one map per row, keyed by column
+func ParseCSV(body []byte) ([]map[string]string, error) {
+	body = bytes.TrimPrefix(bytes.TrimSpace(body), []byte("# "))
+	r := csv.NewReader(bytes.NewReader(body))
+	r.FieldsPerRecord = -1
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error parsing CSV: %v", err)
+	}
+	if len(records) == 0 || len(records[0]) < 2 || records[0][0] != "pxname" || records[0][1] != "svname" {
+		return nil, fmt.Errorf("unrecognized stats page")
+	}
+
+	header := records[0]
+	var result []map[string]string
+	for _, record := range records[1:] {
+		row := make(map[string]string)
+		for i, value := range record {
+			if i < len(header) && header[i] != "" {
+				row[header[i]] = value
+			}
+		}
+		result = append(result, row)
+	}
+	return result, nil
+}
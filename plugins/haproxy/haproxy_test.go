@@ -0,0 +1,71 @@
+package haproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/neocortical/newrelic"
+	"github.com/stretchr/testify/assert"
+)
+
+const testCSV = "# pxname,svname,qcur,qmax,scur,smax,slim,stot,bin,bout,dreq,dresp,ereq,econ,eresp,wretr,wredis,status,weight,act,bck,chkfail,chkdown,lastchg,downtime,qlimit,pid,iid,sid,throttle,lbtot,tracked,type,rate,rate_lim,rate_max,check_status,check_code,check_duration,hrsp_1xx,hrsp_2xx,hrsp_3xx,hrsp_4xx,hrsp_5xx,hrsp_other,hanafail,req_rate,req_rate_max,req_tot,cli_abrt,srv_abrt,comp_in,comp_out,comp_byp,comp_rsp,lastsess,last_chk,last_agt,qtime,ctime,rtime,ttime,\n" +
+	"web,FRONTEND,,,5,20,2000,1200,50000,900000,1,0,3,,,,,OPEN,,,,,,,,,1,2,0,,,,0,4,0,9,,,,0,1100,50,40,10,0,,4,9,1200,,,0,0,0,0,,,,,,,,\n" +
+	"app,app1,0,0,2,8,,600,25000,450000,,0,,0,1,0,0,UP,1,1,0,0,0,100,0,,1,3,1,,600,,2,2,,5,L7OK,200,1,0,550,25,20,5,0,0,,,,3,0,,,,,2,OK,,0,1,12,14,\n" +
+	"app,BACKEND,1,3,3,10,200,1200,50000,900000,0,0,,2,1,0,0,UP,2,2,0,,0,100,0,,1,3,0,,1200,,1,4,,9,,,,0,1100,50,40,10,0,,,,,6,0,0,0,0,0,2,,,0,1,12,14,\n" +
+	"down,BACKEND,0,0,0,0,200,0,0,0,0,0,,0,0,0,0,DOWN,0,0,0,,1,100,100,,1,4,0,,0,,1,0,,0,,,,0,0,0,0,0,0,,,,,0,0,0,0,0,0,-1,,,0,0,0,0,\n"
+
+func Test_ParseCSV(t *testing.T) {
+	rows, err := ParseCSV([]byte(testCSV))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(rows))
+	assert.Equal(t, "web", rows[0]["pxname"])
+	assert.Equal(t, "FRONTEND", rows[0]["svname"])
+	assert.Equal(t, "5", rows[0]["scur"])
+	assert.Equal(t, "14", rows[2]["ttime"])
+
+	_, err = ParseCSV([]byte("<html></html>"))
+	assert.NotNil(t, err)
+	_, err = ParseCSV([]byte(""))
+	assert.NotNil(t, err)
+}
+
+func Test_Source(t *testing.T) {
+	testSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		rw.Write([]byte(testCSV))
+	}))
+	defer testSvr.Close()
+
+	s := New(testSvr.URL + "/stats;csv")
+	_, err := s.PollSamples()
+	assert.NotNil(t, err)
+
+	s.Username, s.Password = "admin", "secret"
+	samples, err := s.PollSamples()
+	assert.Nil(t, err)
+
+	byName := make(map[string]newrelic.Sample)
+	for _, sample := range samples {
+		byName[sample.Name] = sample
+	}
+
+	assert.Equal(t, newrelic.Sample{Name: "HAProxy/web/Frontend/Sessions/Current", Units: "sessions", Value: 5, Kind: newrelic.KindGauge}, byName["HAProxy/web/Frontend/Sessions/Current"])
+	assert.Equal(t, newrelic.Sample{Name: "HAProxy/web/Frontend/Errors/Request", Units: "errors/second", Value: 3, Kind: newrelic.KindRate}, byName["HAProxy/web/Frontend/Errors/Request"])
+	assert.Equal(t, float64(1), byName["HAProxy/web/Frontend/Up"].Value)
+	assert.Equal(t, newrelic.Sample{Name: "HAProxy/app/Responses/5xx", Units: "responses/second", Value: 10, Kind: newrelic.KindRate}, byName["HAProxy/app/Responses/5xx"])
+	assert.Equal(t, newrelic.Sample{Name: "HAProxy/app/Time/Response", Units: "ms", Value: 12, Kind: newrelic.KindGauge}, byName["HAProxy/app/Time/Response"])
+	assert.Equal(t, float64(2), byName["HAProxy/app/Servers/Active"].Value)
+	assert.Equal(t, float64(1), byName["HAProxy/app/Up"].Value)
+	assert.Equal(t, float64(0), byName["HAProxy/down/Up"].Value)
+
+	// servers and frontend-only fields of backends are not reported
+	for name := range byName {
+		assert.NotContains(t, name, "app1")
+	}
+	_, ok := byName["HAProxy/app/Errors/Request"]
+	assert.False(t, ok)
+}
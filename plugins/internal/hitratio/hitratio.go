@@ -0,0 +1,24 @@
+// Package hitratio computes cache hit ratios from cumulative counters
+package hitratio
+
+// Tracker computes the percentage of lookups that hit between polls, given
+// cumulative hit and miss counters
+type Tracker struct {
+	primed bool
+	hits   float64
+	misses float64
+}
+
+// Update records the current counters and returns the hit percentage since
+// the previous update. ok is false on the first update, if there were no
+// lookups, or if the counters were reset.
+func (t *Tracker) Update(hits, misses float64) (ratio float64, ok bool) {
+	dh, dm := hits-t.hits, misses-t.misses
+	primed := t.primed
+	t.primed, t.hits, t.misses = true, hits, misses
+
+	if !primed || dh < 0 || dm < 0 || dh+dm == 0 {
+		return 0, false
+	}
+	return 100 * dh / (dh + dm), true
+}
@@ -0,0 +1,28 @@
+package hitratio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Tracker(t *testing.T) {
+	var tracker Tracker
+
+	_, ok := tracker.Update(10, 10)
+	assert.False(t, ok)
+
+	ratio, ok := tracker.Update(13, 11)
+	assert.True(t, ok)
+	assert.Equal(t, 75.0, ratio)
+
+	_, ok = tracker.Update(13, 11)
+	assert.False(t, ok)
+
+	// reset
+	_, ok = tracker.Update(1, 0)
+	assert.False(t, ok)
+	ratio, ok = tracker.Update(2, 0)
+	assert.True(t, ok)
+	assert.Equal(t, 100.0, ratio)
+}
@@ -0,0 +1,54 @@
+// Package scrape fetches status pages for plugins that poll HTTP endpoints
+package scrape
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	// DefaultTimeout is used when no HTTP client is given
+	DefaultTimeout = 5 * time.Second
+
+	// MaxBodySize guards against unreasonably large status pages
+	MaxBodySize = 4 << 20
+)
+
+var defaultClient = &http.Client{Timeout: DefaultTimeout}
+
+// Get fetches url with client, or a client with DefaultTimeout if nil. Basic
+// auth is sent if username is set. Non-200 responses are errors.
+func Get(client *http.Client, url, username, password string) ([]byte, error) {
+	if client == nil {
+		client = defaultClient
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, MaxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > MaxBodySize {
+		return nil, fmt.Errorf("response is larger than %d bytes", MaxBodySize)
+	}
+	return body, nil
+}
@@ -0,0 +1,31 @@
+package scrape
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Get(t *testing.T) {
+	testSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		rw.Write([]byte("status"))
+	}))
+	defer testSvr.Close()
+
+	body, err := Get(nil, testSvr.URL, "admin", "secret")
+	assert.Nil(t, err)
+	assert.Equal(t, "status", string(body))
+
+	_, err = Get(testSvr.Client(), testSvr.URL, "", "")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "401")
+
+	_, err = Get(nil, "://bad", "", "")
+	assert.NotNil(t, err)
+}
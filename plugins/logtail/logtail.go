@@ -0,0 +1,293 @@
+/*
+Package logtail reports metrics from lines appended to a log file.
+
+	plugin := &newrelic.Plugin{Name: "App Logs", GUID: "com.example.newrelic.applogs"}
+	plugin.AddSource(logtail.New("/var/log/app.log",
+		logtail.Rule{Name: "Errors", Units: "lines", Pattern: regexp.MustCompile(`ERROR`)},
+		logtail.Rule{Name: "Latency", Units: "ms", Pattern: regexp.MustCompile(`took=(\d+)ms`), Value: true},
+	))
+
+The file is read on every poll from where the previous poll stopped, starting
+at its end when first opened. A file that is truncated is read again from the
+start. A file that is renamed or removed and recreated, as log rotation does,
+is read to its end before the new file is read from its start.
+
+Rules that count lines report the number of matching lines per poll. Rules
+with Value set report every number they extract as an aggregate.
+*/
+package logtail
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/neocortical/newrelic"
+)
+
+const (
+	// DefaultPrefix is the default prefix of metric names
+	DefaultPrefix = "Log"
+
+	// DefaultMaxLineSize is the default limit on the length of a line. Longer
+	// lines are skipped.
+	DefaultMaxLineSize = 64 << 10
+
+	readSize = 32 << 10
+)
+
+// Rule matches lines and reports them as a metric
+type Rule struct {
+	Name  string
+	Units string
+
+	Pattern *regexp.Regexp
+
+	// Value, if true, records the number in the pattern's first capture
+	// group rather than counting matching lines. Matches that aren't numbers
+	// are skipped.
+	Value bool
+}
+
+// Source is a newrelic.Source that tails a log file
+type Source struct {
+	// Path is the log file
+	Path string
+
+	// Rules are applied to every line
+	Rules []Rule
+
+	// Prefix is prepended to metric names. The default is DefaultPrefix.
+	Prefix string
+
+	// MaxLineSize limits the length of a line. The default is
+	// DefaultMaxLineSize.
+	MaxLineSize int
+
+	mu        sync.Mutex
+	file      *os.File
+	opened    bool
+	offset    int64
+	partial   []byte
+	overflow  bool
+	counters  []*newrelic.Counter
+	recorders []*newrelic.Recorder
+}
+
+// New creates a source tailing the file at path with rules. Set any options
+// before the first poll.
+func New(path string, rules ...Rule) *Source {
+	return &Source{Path: path, Rules: rules, Prefix: DefaultPrefix}
+}
+
+// PollSamples implements newrelic.Source. Lines read before an error are
+// still reported.
+func (s *Source) PollSamples() ([]newrelic.Sample, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.counters == nil {
+		s.counters = make([]*newrelic.Counter, len(s.Rules))
+		s.recorders = make([]*newrelic.Recorder, len(s.Rules))
+		for i, rule := range s.Rules {
+			if rule.Value {
+				s.recorders[i] = newrelic.NewRecorder(rule.Name, rule.Units)
+			} else {
+				s.counters[i] = newrelic.NewCounter(rule.Name, rule.Units)
+			}
+		}
+	}
+
+	var err newrelic.CompositeError
+	for _, rule := range s.Rules {
+		if rule.Pattern == nil {
+			err = err.Accumulate(fmt.Errorf("log %s: rule %s has no pattern", s.Path, rule.Name))
+		}
+	}
+	if ferr := s.follow(); ferr != nil {
+		err = err.Accumulate(fmt.Errorf("log %s: %v", s.Path, ferr))
+	}
+
+	prefix := s.Prefix
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+
+	var result []newrelic.Sample
+	for i, rule := range s.Rules {
+		name := prefix + "/" + rule.Name
+		if c := s.counters[i]; c != nil {
+			val, _ := c.Poll()
+			result = append(result, newrelic.Sample{Name: name, Units: rule.Units, Value: val, Kind: newrelic.KindCount})
+		} else if agg, _ := s.recorders[i].PollAggregate(); agg.Count > 0 {
+			result = append(result, newrelic.Sample{Name: name, Units: rule.Units, Aggregate: agg})
+		}
+	}
+
+	if err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// Close closes the file being tailed. A later poll opens it again from its
+// end.
+func (s *Source) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.opened = false
+	return s.closeFile()
+}
+
+// follow reads new lines, following truncation and rotation
+func (s *Source) follow() error {
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	current, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+	if current.Size() < s.offset {
+		if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		s.offset = 0
+		s.partial = s.partial[:0]
+		s.overflow = false
+	}
+	if err := s.read(); err != nil {
+		return err
+	}
+
+	// a missing file is expected briefly during rotation, so keep the old one
+	latest, err := os.Stat(s.Path)
+	if err != nil || os.SameFile(current, latest) {
+		return nil
+	}
+
+	// the old file ended without a newline
+	s.line()
+	if err := s.closeFile(); err != nil {
+		return err
+	}
+	if err := s.open(); err != nil {
+		return err
+	}
+	return s.read()
+}
+
+// open opens the file at its end the first time, and otherwise at its start
+func (s *Source) open() error {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return err
+	}
+
+	s.offset = 0
+	if !s.opened {
+		if s.offset, err = f.Seek(0, io.SeekEnd); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	s.file = f
+	s.opened = true
+	return nil
+}
+
+func (s *Source) closeFile() error {
+	s.partial = s.partial[:0]
+	s.overflow = false
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// read reads the file to its end, applying rules to complete lines
+func (s *Source) read() error {
+	buf := make([]byte, readSize)
+	for {
+		n, err := s.file.Read(buf)
+		s.offset += int64(n)
+		s.consume(buf[:n])
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Source) consume(b []byte) {
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			s.appendPartial(b)
+			return
+		}
+		s.appendPartial(b[:i])
+		s.line()
+		b = b[i+1:]
+	}
+}
+
+// appendPartial buffers part of a line, dropping lines that are too long
+func (s *Source) appendPartial(b []byte) {
+	max := s.MaxLineSize
+	if max <= 0 {
+		max = DefaultMaxLineSize
+	}
+	if s.overflow {
+		return
+	}
+	if len(s.partial)+len(b) > max {
+		s.partial = s.partial[:0]
+		s.overflow = true
+		return
+	}
+	s.partial = append(s.partial, b...)
+}
+
+// line applies rules to the buffered line and resets it
+func (s *Source) line() {
+	if !s.overflow && len(s.partial) > 0 {
+		s.match(bytes.TrimSuffix(s.partial, []byte("\r")))
+	}
+	s.partial = s.partial[:0]
+	s.overflow = false
+}
+
+func (s *Source) match(line []byte) {
+	for i, rule := range s.Rules {
+		if rule.Pattern == nil {
+			continue
+		}
+		if !rule.Value {
+			if rule.Pattern.Match(line) {
+				s.counters[i].Inc()
+			}
+			continue
+		}
+
+		m := rule.Pattern.FindSubmatch(line)
+		if len(m) < 2 {
+			continue
+		}
+		if v, err := strconv.ParseFloat(string(m[1]), 64); err == nil {
+			s.recorders[i].Record(v)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package logtail
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/neocortical/newrelic"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSource(t *testing.T) (*Source, string) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	writeLog(t, path, "ERROR before the source started\n")
+
+	s := New(path,
+		Rule{Name: "Errors", Units: "lines", Pattern: regexp.MustCompile(`ERROR`)},
+		Rule{Name: "Latency", Units: "ms", Pattern: regexp.MustCompile(`took=(\d+)ms`), Value: true},
+	)
+	t.Cleanup(func() { s.Close() })
+	return s, path
+}
+
+func writeLog(t *testing.T, path, lines string) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(t, err)
+	_, err = f.WriteString(lines)
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+}
+
+func poll(t *testing.T, s *Source) map[string]newrelic.Sample {
+	samples, err := s.PollSamples()
+	assert.Nil(t, err)
+	result := make(map[string]newrelic.Sample)
+	for _, sample := range samples {
+		result[sample.Name] = sample
+	}
+	return result
+}
+
+func Test_Source(t *testing.T) {
+	s, path := testSource(t)
+
+	samples := poll(t, s)
+	assert.Equal(t, newrelic.Sample{Name: "Log/Errors", Units: "lines", Kind: newrelic.KindCount}, samples["Log/Errors"])
+	_, ok := samples["Log/Latency"]
+	assert.False(t, ok)
+
+	writeLog(t, path, "INFO took=10ms\r\nERROR took=30ms\nERROR took=abcms\nERROR partial")
+	samples = poll(t, s)
+	assert.Equal(t, float64(2), samples["Log/Errors"].Value)
+	agg := samples["Log/Latency"].Aggregate
+	assert.Equal(t, 2, agg.Count)
+	assert.Equal(t, float64(40), agg.Total)
+	assert.Equal(t, float64(10), agg.Min)
+	assert.Equal(t, float64(30), agg.Max)
+
+	writeLog(t, path, " line\n")
+	samples = poll(t, s)
+	assert.Equal(t, float64(1), samples["Log/Errors"].Value)
+}
+
+func Test_Source_truncate(t *testing.T) {
+	s, path := testSource(t)
+	poll(t, s)
+
+	assert.Nil(t, os.Truncate(path, 0))
+	writeLog(t, path, "ERROR\n")
+	assert.Equal(t, float64(1), poll(t, s)["Log/Errors"].Value)
+}
+
+func Test_Source_rotate(t *testing.T) {
+	s, path := testSource(t)
+	poll(t, s)
+
+	writeLog(t, path, "ERROR one\nERROR two")
+	assert.Nil(t, os.Rename(path, path+".1"))
+	assert.Equal(t, float64(1), poll(t, s)["Log/Errors"].Value)
+
+	writeLog(t, path+".1", "\n")
+	writeLog(t, path, "ERROR three\nERROR four\n")
+	assert.Equal(t, float64(3), poll(t, s)["Log/Errors"].Value)
+
+	assert.Nil(t, os.Remove(path))
+	writeLog(t, path, "ERROR five\n")
+	assert.Equal(t, float64(1), poll(t, s)["Log/Errors"].Value)
+}
+
+func Test_Source_longLine(t *testing.T) {
+	s, path := testSource(t)
+	s.MaxLineSize = 10
+	poll(t, s)
+
+	writeLog(t, path, "ERROR "+strings.Repeat("x", 20)+"\nERROR\n")
+	assert.Equal(t, float64(1), poll(t, s)["Log/Errors"].Value)
+}
+
+func Test_Source_errors(t *testing.T) {
+	s := New(filepath.Join(t.TempDir(), "missing.log"), Rule{Name: "Errors", Units: "lines"})
+	samples, err := s.PollSamples()
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, len(err.(newrelic.CompositeError)))
+	assert.Equal(t, 1, len(samples))
+}
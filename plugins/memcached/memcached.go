@@ -0,0 +1,151 @@
+/*
+Package memcached reports memcached server statistics from the stats command
+of the text protocol.
+
+	plugin := &newrelic.Plugin{Name: "Cache", GUID: "com.example.newrelic.cache"}
+	plugin.AddSource(memcached.New("localhost:11211"))
+
+Connections, memory and items are reported as gauges. Cumulative counters
+such as gets, hits and evictions are reported as per-second rates, along with
+the get hit ratio since the previous poll.
+*/
+package memcached
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neocortical/newrelic"
+	"github.com/neocortical/newrelic/plugins/internal/hitratio"
+)
+
+const (
+	// DefaultPrefix is the default prefix of metric names
+	DefaultPrefix = "Memcached"
+
+	// DefaultTimeout is the default limit on connecting and reading a reply
+	DefaultTimeout = 5 * time.Second
+
+	// maxStats guards against a reply that never ends
+	maxStats = 1000
+)
+
+type field struct {
+	key   string
+	name  string
+	units string
+	kind  string
+}
+
+var fields = []field{
+	{"curr_connections", "Connections/Current", "connections", newrelic.KindGauge},
+	{"total_connections", "Connections/Opened", "connections/second", newrelic.KindRate},
+	{"bytes", "Memory/Used", "bytes", newrelic.KindGauge},
+	{"limit_maxbytes", "Memory/Limit", "bytes", newrelic.KindGauge},
+	{"curr_items", "Items/Current", "items", newrelic.KindGauge},
+	{"evictions", "Items/Evicted", "items/second", newrelic.KindRate},
+	{"cmd_get", "Commands/Get", "commands/second", newrelic.KindRate},
+	{"cmd_set", "Commands/Set", "commands/second", newrelic.KindRate},
+	{"get_hits", "Gets/Hits", "hits/second", newrelic.KindRate},
+	{"get_misses", "Gets/Misses", "misses/second", newrelic.KindRate},
+}
+
+// Source is a newrelic.Source that polls a memcached server's stats
+type Source struct {
+	// Addr is the server's host:port
+	Addr string
+
+	// Prefix is prepended to metric names. The default is DefaultPrefix.
+	Prefix string
+
+	// Timeout limits connecting and reading each poll. The default is
+	// DefaultTimeout.
+	Timeout time.Duration
+
+	hits hitratio.Tracker
+}
+
+// New creates a source polling the server at addr
+func New(addr string) *Source {
+	return &Source{Addr: addr, Prefix: DefaultPrefix}
+}
+
+// PollSamples implements newrelic.Source
+func (s *Source) PollSamples() ([]newrelic.Sample, error) {
+	values, err := s.stats()
+	if err != nil {
+		return nil, fmt.Errorf("memcached %s: %v", s.Addr, err)
+	}
+
+	prefix := s.Prefix
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+
+	var result []newrelic.Sample
+	for _, f := range fields {
+		v, ok := values[f.key]
+		if !ok {
+			continue
+		}
+		result = append(result, newrelic.Sample{Name: prefix + "/" + f.name, Units: f.units, Value: v, Kind: f.kind})
+	}
+
+	if ratio, ok := s.hits.Update(values["get_hits"], values["get_misses"]); ok {
+		result = append(result, newrelic.Sample{Name: prefix + "/Gets/Hit Ratio", Units: "%", Value: ratio})
+	}
+	return result, nil
+}
+
+// stats sends the stats command and parses the reply
+func (s *Source) stats() (map[string]float64, error) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	conn, err := net.DialTimeout("tcp", s.Addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := conn.Write([]byte("stats\r\n")); err != nil {
+		return nil, err
+	}
+	return ParseStats(bufio.NewReader(conn))
+}
+
+// ParseStats reads a stats reply up to its END line. Non-numeric stats such
+// as the version are skipped.
+func ParseStats(r *bufio.Reader) (map[string]float64, error) {
+	result := make(map[string]float64)
+	for i := 0; i < maxStats; i++ {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "END":
+			return result, nil
+		case line == "ERROR", strings.HasPrefix(line, "CLIENT_ERROR"), strings.HasPrefix(line, "SERVER_ERROR"):
+			return nil, fmt.Errorf("server error: %s", line)
+		}
+
+		parts := strings.Fields(line)
+		if len(parts) != 3 || parts[0] != "STAT" {
+			return nil, fmt.Errorf("unexpected line %q", line)
+		}
+		if v, err := strconv.ParseFloat(parts[2], 64); err == nil {
+			result[parts[1]] = v
+		}
+	}
+	return nil, fmt.Errorf("reply has more than %d stats", maxStats)
+}
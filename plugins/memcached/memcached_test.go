@@ -0,0 +1,83 @@
+package memcached
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/neocortical/newrelic"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServer answers stats like a memcached server. Each reply adds three
+// hits and one miss.
+func fakeServer(t *testing.T) (addr string, closeFn func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	hits, misses := 0, 0
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			if strings.TrimSpace(line) == "stats" {
+				fmt.Fprintf(conn, "STAT pid 1\r\nSTAT version 1.6.21\r\nSTAT curr_connections 4\r\n"+
+					"STAT bytes 2048\r\nSTAT get_hits %d\r\nSTAT get_misses %d\r\nSTAT evictions 0\r\nEND\r\n", hits, misses)
+				hits, misses = hits+3, misses+1
+			} else {
+				conn.Write([]byte("ERROR\r\n"))
+			}
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String(), func() { ln.Close() }
+}
+
+func Test_ParseStats(t *testing.T) {
+	values, err := ParseStats(bufio.NewReader(strings.NewReader("STAT curr_items 12\r\nSTAT version 1.6.21\r\nEND\r\n")))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]float64{"curr_items": 12}, values)
+
+	_, err = ParseStats(bufio.NewReader(strings.NewReader("SERVER_ERROR out of memory\r\n")))
+	assert.NotNil(t, err)
+	_, err = ParseStats(bufio.NewReader(strings.NewReader("STAT curr_items 12\r\n")))
+	assert.NotNil(t, err)
+	_, err = ParseStats(bufio.NewReader(strings.NewReader("garbage\r\nEND\r\n")))
+	assert.NotNil(t, err)
+}
+
+func Test_Source(t *testing.T) {
+	addr, closeFn := fakeServer(t)
+	defer closeFn()
+
+	src := New(addr)
+	plugin := &newrelic.Plugin{Name: "Cache", GUID: "com.example.cache"}
+	plugin.AddSource(src)
+	client := newrelic.New("abc123")
+	client.AddPlugin(plugin)
+
+	request, err := client.GenerateRequest()
+	assert.Nil(t, err)
+	metrics := request.Plugins[0].Metrics
+	assert.Equal(t, 4.0, metrics["Component/Memcached/Connections/Current[connections]"])
+	assert.Equal(t, 2048.0, metrics["Component/Memcached/Memory/Used[bytes]"])
+
+	samples, err := src.PollSamples()
+	assert.Nil(t, err)
+	var ratio float64
+	for _, s := range samples {
+		if s.Name == "Memcached/Gets/Hit Ratio" {
+			ratio = s.Value
+		}
+	}
+	assert.Equal(t, 75.0, ratio)
+
+	closeFn()
+	_, err = src.PollSamples()
+	assert.NotNil(t, err)
+}
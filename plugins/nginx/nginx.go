@@ -0,0 +1,102 @@
+/*
+Package nginx reports nginx connection and request statistics from the
+stub_status page.
+
+	plugin := &newrelic.Plugin{Name: "Web", GUID: "com.example.newrelic.web"}
+	plugin.AddSource(nginx.New("http://localhost/nginx_status"))
+
+Active, reading, writing and waiting connections are reported as gauges.
+Accepted, handled and dropped connections and requests are reported as
+per-second rates.
+*/
+package nginx
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/neocortical/newrelic"
+	"github.com/neocortical/newrelic/plugins/internal/scrape"
+)
+
+// DefaultPrefix is the default prefix of metric names
+const DefaultPrefix = "Nginx"
+
+var statusPattern = regexp.MustCompile(`(?s)Active connections:\s*(\d+).*?` +
+	`server accepts handled requests\s+(\d+)\s+(\d+)\s+(\d+).*?` +
+	`Reading:\s*(\d+)\s+Writing:\s*(\d+)\s+Waiting:\s*(\d+)`)
+
+// Status holds the values of a stub_status page
+type Status struct {
+	Active   float64
+	Accepts  float64
+	Handled  float64
+	Requests float64
+	Reading  float64
+	Writing  float64
+	Waiting  float64
+}
+
+// Source is a newrelic.Source that scrapes a stub_status page
+type Source struct {
+	// URL is the stub_status page
+	URL string
+
+	// Client fetches the page. A client with scrape.DefaultTimeout is used
+	// when nil.
+	Client *http.Client
+
+	// Prefix is prepended to metric names. The default is DefaultPrefix.
+	Prefix string
+}
+
+// New creates a source scraping the stub_status page at url
+func New(url string) *Source {
+	return &Source{URL: url, Prefix: DefaultPrefix}
+}
+
+// PollSamples implements newrelic.Source
+func (s *Source) PollSamples() ([]newrelic.Sample, error) {
+	body, err := scrape.Get(s.Client, s.URL, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("nginx %s: %v", s.URL, err)
+	}
+	status, err := ParseStatus(body)
+	if err != nil {
+		return nil, fmt.Errorf("nginx %s: %v", s.URL, err)
+	}
+
+	prefix := s.Prefix
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return []newrelic.Sample{
+		{Name: prefix + "/Connections/Active", Units: "connections", Value: status.Active},
+		{Name: prefix + "/Connections/Reading", Units: "connections", Value: status.Reading},
+		{Name: prefix + "/Connections/Writing", Units: "connections", Value: status.Writing},
+		{Name: prefix + "/Connections/Waiting", Units: "connections", Value: status.Waiting},
+		{Name: prefix + "/Connections/Accepted", Units: "connections/second", Value: status.Accepts, Kind: newrelic.KindRate},
+		{Name: prefix + "/Connections/Handled", Units: "connections/second", Value: status.Handled, Kind: newrelic.KindRate},
+		{Name: prefix + "/Connections/Dropped", Units: "connections/second", Value: status.Accepts - status.Handled, Kind: newrelic.KindRate},
+		{Name: prefix + "/Requests", Units: "requests/second", Value: status.Requests, Kind: newrelic.KindRate},
+	}, nil
+}
+
+// ParseStatus parses a stub_status page
+func ParseStatus(body []byte) (status Status, err error) {
+	match := statusPattern.FindSubmatch(body)
+	if match == nil {
+		return status, fmt.Errorf("unrecognized stub_status page")
+	}
+
+	fields := []*float64{&status.Active, &status.Accepts, &status.Handled, &status.Requests,
+		&status.Reading, &status.Writing, &status.Waiting}
+	for i, f := range fields {
+		if *f, err = strconv.ParseFloat(string(match[i+1]), 64); err != nil {
+			return status, err
+		}
+	}
+	return status, nil
+}
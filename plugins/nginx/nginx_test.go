@@ -0,0 +1,56 @@
+package nginx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/neocortical/newrelic"
+	"github.com/stretchr/testify/assert"
+)
+
+const testStatus = "Active connections: 291 \n" +
+	"server accepts handled requests\n" +
+	" 16630948 16630940 31070465 \n" +
+	"Reading: 6 Writing: 179 Waiting: 106 \n"
+
+func Test_ParseStatus(t *testing.T) {
+	status, err := ParseStatus([]byte(testStatus))
+	assert.Nil(t, err)
+	assert.Equal(t, Status{
+		Active:   291,
+		Accepts:  16630948,
+		Handled:  16630940,
+		Requests: 31070465,
+		Reading:  6,
+		Writing:  179,
+		Waiting:  106,
+	}, status)
+
+	_, err = ParseStatus([]byte("<html>not found</html>"))
+	assert.NotNil(t, err)
+}
+
+func Test_Source(t *testing.T) {
+	testSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(testStatus))
+	}))
+	defer testSvr.Close()
+
+	samples, err := New(testSvr.URL).PollSamples()
+	assert.Nil(t, err)
+	assert.Equal(t, 8, len(samples))
+	assert.Equal(t, newrelic.Sample{Name: "Nginx/Connections/Active", Units: "connections", Value: 291}, samples[0])
+	assert.Equal(t, newrelic.Sample{Name: "Nginx/Connections/Dropped", Units: "connections/second", Value: 8, Kind: newrelic.KindRate}, samples[6])
+	assert.Equal(t, newrelic.Sample{Name: "Nginx/Requests", Units: "requests/second", Value: 31070465, Kind: newrelic.KindRate}, samples[7])
+}
+
+func Test_Source_error(t *testing.T) {
+	testSvr := httptest.NewServer(http.NotFoundHandler())
+	defer testSvr.Close()
+
+	s := &Source{URL: testSvr.URL, Client: testSvr.Client()}
+	_, err := s.PollSamples()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "404")
+}
@@ -0,0 +1,294 @@
+/*
+Package probe reports the availability of HTTP and TCP endpoints, turning a
+plugin into a lightweight uptime monitor.
+
+	plugin := &newrelic.Plugin{Name: "Uptime", GUID: "com.example.newrelic.uptime"}
+	plugin.AddSource(probe.New(
+		probe.Target{URL: "https://example.com/health"},
+		probe.Target{Name: "Database", Addr: "db.internal:5432"},
+	))
+
+Every target is probed concurrently on each poll. Metrics are named
+Probe/<target>/... and include whether the target is up, the latency of the
+probe and, for HTTP targets, the status code and response size. HTTPS
+targets, and TCP targets with TLS set, also report the days remaining until
+their certificate expires.
+
+A target that is down is reported as such rather than as an error. A target
+whose certificate fails verification, e.g. because it has expired, is down but
+still reports the days remaining, which are then zero or negative.
+*/
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neocortical/newrelic"
+)
+
+const (
+	// DefaultPrefix is the default prefix of metric names
+	DefaultPrefix = "Probe"
+
+	// DefaultTimeout is the default limit on each probe
+	DefaultTimeout = 10 * time.Second
+
+	// maxBodySize limits how much of a response body is read
+	maxBodySize = 10 << 20
+)
+
+// Target is an endpoint to probe. Exactly one of URL and Addr is set.
+type Target struct {
+	// Name groups the target's metrics. The default is the URL without its
+	// scheme, or Addr.
+	Name string
+
+	// URL is fetched with GET. The target is up if the response status is
+	// below 400, or equal to ExpectStatus if that is set.
+	URL          string
+	ExpectStatus int
+
+	// Addr is a TCP host:port. The target is up if a connection, and a TLS
+	// handshake if TLS is set, succeeds.
+	Addr string
+	TLS  bool
+}
+
+// Source is a newrelic.Source that probes targets
+type Source struct {
+	Targets []Target
+
+	// Prefix is prepended to metric names. The default is DefaultPrefix.
+	Prefix string
+
+	// Timeout limits each probe. The default is DefaultTimeout.
+	Timeout time.Duration
+
+	// Client makes HTTP probes. The default doesn't reuse connections, so
+	// that latency includes connecting. Its own timeout still applies.
+	Client *http.Client
+
+	// TLSConfig is used by TCP probes with TLS set
+	TLSConfig *tls.Config
+}
+
+// New creates a source probing targets
+func New(targets ...Target) *Source {
+	return &Source{Targets: targets, Prefix: DefaultPrefix}
+}
+
+// result is the outcome of a single probe
+type result struct {
+	up       bool
+	latency  time.Duration
+	status   int
+	size     int64
+	notAfter time.Time
+}
+
+// PollSamples implements newrelic.Source. Targets that are invalid are
+// reported in the error.
+func (s *Source) PollSamples() ([]newrelic.Sample, error) {
+	prefix := s.Prefix
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+
+	var err newrelic.CompositeError
+	var targets []Target
+	var names []string
+	for _, t := range s.Targets {
+		name, terr := t.name()
+		if terr != nil {
+			err = err.Accumulate(terr)
+			continue
+		}
+		targets = append(targets, t)
+		names = append(names, name)
+	}
+
+	results := make([]result, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t Target) {
+			defer wg.Done()
+			if t.URL != "" {
+				results[i] = s.probeHTTP(t)
+			} else {
+				results[i] = s.probeTCP(t)
+			}
+		}(i, t)
+	}
+	wg.Wait()
+
+	var samples []newrelic.Sample
+	for i, r := range results {
+		base := prefix + "/" + names[i] + "/"
+		up := 0.0
+		if r.up {
+			up = 1
+		}
+		samples = append(samples, newrelic.Sample{Name: base + "Up", Units: "boolean", Value: up})
+		if r.latency > 0 {
+			samples = append(samples, newrelic.Sample{Name: base + "Latency", Units: "ms", Value: float64(r.latency) / float64(time.Millisecond)})
+		}
+		if r.status != 0 {
+			samples = append(samples,
+				newrelic.Sample{Name: base + "Status Code", Units: "code", Value: float64(r.status)},
+				newrelic.Sample{Name: base + "Response Size", Units: "bytes", Value: float64(r.size)},
+			)
+		}
+		if !r.notAfter.IsZero() {
+			days := time.Until(r.notAfter).Hours() / 24
+			samples = append(samples, newrelic.Sample{Name: base + "Certificate/Days Remaining", Units: "days", Value: days})
+		}
+	}
+
+	if err != nil {
+		return samples, err
+	}
+	return samples, nil
+}
+
+func (t Target) name() (string, error) {
+	switch {
+	case t.URL != "" && t.Addr != "":
+		return "", fmt.Errorf("probe target %s has both a URL and an address", t.Name)
+	case t.URL != "":
+		u, err := url.Parse(t.URL)
+		if err != nil {
+			return "", fmt.Errorf("probe target %s: %v", t.Name, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return "", fmt.Errorf("probe target %s has unsupported URL %s", t.Name, t.URL)
+		}
+		if t.Name != "" {
+			return t.Name, nil
+		}
+		return strings.TrimSuffix(u.Host+u.Path, "/"), nil
+	case t.Addr != "":
+		if t.Name != "" {
+			return t.Name, nil
+		}
+		return t.Addr, nil
+	}
+	return "", fmt.Errorf("probe target %s has no URL or address", t.Name)
+}
+
+func (s *Source) timeout() time.Duration {
+	if s.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return s.Timeout
+}
+
+func (s *Source) probeHTTP(t Target) (r result) {
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Transport: &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			DisableKeepAlives: true,
+		}}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", t.URL, nil)
+	if err != nil {
+		return r
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		if u := req.URL; u.Scheme == "https" {
+			port := u.Port()
+			if port == "" {
+				port = "443"
+			}
+			r.notAfter = s.inspectCertificate(net.JoinHostPort(u.Hostname(), port), nil)
+		}
+		return r
+	}
+	defer resp.Body.Close()
+
+	r.size, err = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxBodySize))
+	r.latency = time.Since(start)
+	r.status = resp.StatusCode
+	if resp.TLS != nil {
+		r.notAfter = notAfter(resp.TLS.PeerCertificates)
+	}
+
+	if t.ExpectStatus != 0 {
+		r.up = resp.StatusCode == t.ExpectStatus
+	} else {
+		r.up = resp.StatusCode < 400
+	}
+	r.up = r.up && err == nil
+	return r
+}
+
+func (s *Source) probeTCP(t Target) (r result) {
+	dialer := &net.Dialer{Timeout: s.timeout()}
+
+	start := time.Now()
+	if !t.TLS {
+		conn, err := dialer.Dial("tcp", t.Addr)
+		if err != nil {
+			return r
+		}
+		r.latency = time.Since(start)
+		r.up = true
+		conn.Close()
+		return r
+	}
+
+	conn, err := tls.DialWithDialer(dialer, "tcp", t.Addr, s.TLSConfig)
+	if err != nil {
+		r.notAfter = s.inspectCertificate(t.Addr, s.TLSConfig)
+		return r
+	}
+	r.latency = time.Since(start)
+	r.up = true
+	r.notAfter = notAfter(conn.ConnectionState().PeerCertificates)
+	conn.Close()
+	return r
+}
+
+// inspectCertificate returns the expiry of the certificate at addr without
+// verifying it, for targets whose probe failed, possibly because verification
+// did. It returns the zero time if there is no certificate to inspect.
+func (s *Source) inspectCertificate(addr string, config *tls.Config) time.Time {
+	if config == nil {
+		config = &tls.Config{}
+	}
+	config = config.Clone()
+	config.InsecureSkipVerify = true
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: s.timeout()}, "tcp", addr, config)
+	if err != nil {
+		return time.Time{}
+	}
+	defer conn.Close()
+	return notAfter(conn.ConnectionState().PeerCertificates)
+}
+
+// notAfter returns the expiry of the leaf certificate
+func notAfter(certs []*x509.Certificate) time.Time {
+	if len(certs) == 0 {
+		return time.Time{}
+	}
+	return certs[0].NotAfter
+}
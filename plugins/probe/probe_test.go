@@ -0,0 +1,145 @@
+package probe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neocortical/newrelic"
+	"github.com/stretchr/testify/assert"
+)
+
+func samplesByName(samples []newrelic.Sample) map[string]newrelic.Sample {
+	result := make(map[string]newrelic.Sample)
+	for _, s := range samples {
+		result[s.Name] = s
+	}
+	return result
+}
+
+func Test_Source_http(t *testing.T) {
+	testSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			rw.WriteHeader(http.StatusInternalServerError)
+		}
+		rw.Write([]byte("hello"))
+	}))
+	defer testSvr.Close()
+	host := strings.TrimPrefix(testSvr.URL, "http://")
+
+	s := New(
+		Target{URL: testSvr.URL + "/health"},
+		Target{Name: "Broken", URL: testSvr.URL + "/broken"},
+		Target{Name: "Expected", URL: testSvr.URL + "/broken", ExpectStatus: 500},
+	)
+	samples, err := s.PollSamples()
+	assert.Nil(t, err)
+	byName := samplesByName(samples)
+
+	assert.Equal(t, float64(1), byName["Probe/"+host+"/health/Up"].Value)
+	assert.Equal(t, float64(200), byName["Probe/"+host+"/health/Status Code"].Value)
+	assert.Equal(t, newrelic.Sample{Name: "Probe/" + host + "/health/Response Size", Units: "bytes", Value: 5}, byName["Probe/"+host+"/health/Response Size"])
+	assert.True(t, byName["Probe/"+host+"/health/Latency"].Value > 0)
+	_, ok := byName["Probe/"+host+"/health/Certificate/Days Remaining"]
+	assert.False(t, ok)
+
+	assert.Equal(t, float64(0), byName["Probe/Broken/Up"].Value)
+	assert.Equal(t, float64(500), byName["Probe/Broken/Status Code"].Value)
+	assert.Equal(t, float64(1), byName["Probe/Expected/Up"].Value)
+}
+
+func Test_Source_https(t *testing.T) {
+	testSvr := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	defer testSvr.Close()
+
+	s := New(Target{Name: "Secure", URL: testSvr.URL})
+	s.Client = testSvr.Client()
+	samples, err := s.PollSamples()
+	assert.Nil(t, err)
+	byName := samplesByName(samples)
+
+	assert.Equal(t, float64(1), byName["Probe/Secure/Up"].Value)
+	expected := time.Until(testSvr.Certificate().NotAfter).Hours() / 24
+	assert.InDelta(t, expected, byName["Probe/Secure/Certificate/Days Remaining"].Value, 0.01)
+}
+
+func Test_Source_untrustedCertificate(t *testing.T) {
+	tlsSvr := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	defer tlsSvr.Close()
+
+	s := New(
+		Target{Name: "HTTPS", URL: tlsSvr.URL},
+		Target{Name: "TLS", Addr: tlsSvr.Listener.Addr().String(), TLS: true},
+	)
+	s.Timeout = time.Second
+	samples, err := s.PollSamples()
+	assert.Nil(t, err)
+	byName := samplesByName(samples)
+
+	// the targets are down, but their certificate's expiry is still reported
+	expected := time.Until(tlsSvr.Certificate().NotAfter).Hours() / 24
+	for _, name := range []string{"HTTPS", "TLS"} {
+		assert.Equal(t, float64(0), byName["Probe/"+name+"/Up"].Value)
+		assert.InDelta(t, expected, byName["Probe/"+name+"/Certificate/Days Remaining"].Value, 0.01)
+	}
+}
+
+func Test_Source_tcp(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	closed.Close()
+
+	tlsSvr := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	defer tlsSvr.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(tlsSvr.Certificate())
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	defer listener.Close()
+
+	s := New(
+		Target{Name: "Open", Addr: listener.Addr().String()},
+		Target{Name: "Closed", Addr: closed.Addr().String()},
+		Target{Name: "TLS", Addr: tlsSvr.Listener.Addr().String(), TLS: true},
+	)
+	s.Timeout = time.Second
+	s.TLSConfig = &tls.Config{RootCAs: roots, ServerName: "example.com"}
+	samples, err := s.PollSamples()
+	assert.Nil(t, err)
+	byName := samplesByName(samples)
+
+	assert.Equal(t, float64(1), byName["Probe/Open/Up"].Value)
+	assert.True(t, byName["Probe/Open/Latency"].Value > 0)
+	assert.Equal(t, float64(0), byName["Probe/Closed/Up"].Value)
+	_, ok := byName["Probe/Closed/Latency"]
+	assert.False(t, ok)
+	assert.Equal(t, float64(1), byName["Probe/TLS/Up"].Value)
+	assert.True(t, byName["Probe/TLS/Certificate/Days Remaining"].Value > 0)
+}
+
+func Test_Source_invalid(t *testing.T) {
+	s := New(
+		Target{},
+		Target{Name: "Both", URL: "http://example.com", Addr: "example.com:80"},
+		Target{Name: "FTP", URL: "ftp://example.com"},
+	)
+	samples, err := s.PollSamples()
+	assert.Equal(t, 0, len(samples))
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, len(err.(newrelic.CompositeError)))
+}
@@ -0,0 +1,219 @@
+/*
+Package redis reports Redis server statistics from the INFO command.
+
+	plugin := &newrelic.Plugin{Name: "Cache", GUID: "com.example.newrelic.cache"}
+	plugin.AddSource(redis.New("localhost:6379"))
+
+Clients, memory and keys are reported as gauges. Cumulative counters such as
+commands processed, keyspace hits and evictions are reported as per-second
+rates, along with the keyspace hit ratio since the previous poll.
+*/
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neocortical/newrelic"
+	"github.com/neocortical/newrelic/plugins/internal/hitratio"
+)
+
+const (
+	// DefaultPrefix is the default prefix of metric names
+	DefaultPrefix = "Redis"
+
+	// DefaultTimeout is the default limit on connecting and reading a reply
+	DefaultTimeout = 5 * time.Second
+
+	// maxReplySize guards against unreasonable INFO replies
+	maxReplySize = 1 << 20
+)
+
+type field struct {
+	key   string
+	name  string
+	units string
+	kind  string
+}
+
+var fields = []field{
+	{"connected_clients", "Clients/Connected", "clients", newrelic.KindGauge},
+	{"blocked_clients", "Clients/Blocked", "clients", newrelic.KindGauge},
+	{"total_connections_received", "Connections/Received", "connections/second", newrelic.KindRate},
+	{"rejected_connections", "Connections/Rejected", "connections/second", newrelic.KindRate},
+	{"used_memory", "Memory/Used", "bytes", newrelic.KindGauge},
+	{"used_memory_rss", "Memory/RSS", "bytes", newrelic.KindGauge},
+	{"maxmemory", "Memory/Max", "bytes", newrelic.KindGauge},
+	{"total_commands_processed", "Commands/Processed", "commands/second", newrelic.KindRate},
+	{"keyspace_hits", "Keyspace/Hits", "hits/second", newrelic.KindRate},
+	{"keyspace_misses", "Keyspace/Misses", "misses/second", newrelic.KindRate},
+	{"evicted_keys", "Keys/Evicted", "keys/second", newrelic.KindRate},
+	{"expired_keys", "Keys/Expired", "keys/second", newrelic.KindRate},
+}
+
+// Source is a newrelic.Source that polls a Redis server's INFO
+type Source struct {
+	// Addr is the server's host:port
+	Addr string
+
+	// Password, if set, is sent with AUTH before INFO
+	Password string
+
+	// Prefix is prepended to metric names. The default is DefaultPrefix.
+	Prefix string
+
+	// Timeout limits connecting and reading each poll. The default is
+	// DefaultTimeout.
+	Timeout time.Duration
+
+	hits hitratio.Tracker
+}
+
+// New creates a source polling the server at addr
+func New(addr string) *Source {
+	return &Source{Addr: addr, Prefix: DefaultPrefix}
+}
+
+// PollSamples implements newrelic.Source
+func (s *Source) PollSamples() ([]newrelic.Sample, error) {
+	info, err := s.info()
+	if err != nil {
+		return nil, fmt.Errorf("redis %s: %v", s.Addr, err)
+	}
+	values := ParseInfo(info)
+
+	prefix := s.Prefix
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+
+	var result []newrelic.Sample
+	for _, f := range fields {
+		v, ok := values[f.key]
+		if !ok {
+			continue
+		}
+		result = append(result, newrelic.Sample{Name: prefix + "/" + f.name, Units: f.units, Value: v, Kind: f.kind})
+	}
+
+	var keys float64
+	for k, v := range values {
+		if strings.HasPrefix(k, "db") && strings.HasSuffix(k, ".keys") {
+			keys += v
+		}
+	}
+	result = append(result, newrelic.Sample{Name: prefix + "/Keys/Total", Units: "keys", Value: keys})
+
+	if ratio, ok := s.hits.Update(values["keyspace_hits"], values["keyspace_misses"]); ok {
+		result = append(result, newrelic.Sample{Name: prefix + "/Keyspace/Hit Ratio", Units: "%", Value: ratio})
+	}
+	return result, nil
+}
+
+// info sends INFO, authenticating first if needed, and returns the reply
+func (s *Source) info() (string, error) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	conn, err := net.DialTimeout("tcp", s.Addr, timeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	r := bufio.NewReader(conn)
+
+	if s.Password != "" {
+		if _, err := conn.Write(command("AUTH", s.Password)); err != nil {
+			return "", err
+		}
+		if _, err := readReply(r); err != nil {
+			return "", fmt.Errorf("AUTH failed: %v", err)
+		}
+	}
+
+	if _, err := conn.Write(command("INFO")); err != nil {
+		return "", err
+	}
+	return readReply(r)
+}
+
+// command encodes a command as a RESP array of bulk strings
+func command(args ...string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return []byte(b.String())
+}
+
+// readReply reads a simple string, error or bulk string reply
+func readReply(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", fmt.Errorf("empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return "", fmt.Errorf("server error: %s", line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 || n > maxReplySize {
+			return "", fmt.Errorf("invalid bulk reply length %q", line[1:])
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
+		return string(buf[:n]), nil
+	}
+	return "", fmt.Errorf("unexpected reply %q", line)
+}
+
+// ParseInfo parses numeric fields from an INFO reply. Keyspace lines such as
+// "db0:keys=5,expires=1" become "db0.keys" and "db0.expires". Other
+// non-numeric fields are skipped.
+func ParseInfo(info string) map[string]float64 {
+	result := make(map[string]float64)
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sep := strings.IndexByte(line, ':')
+		if sep < 0 {
+			continue
+		}
+		key, value := line[:sep], line[sep+1:]
+
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			result[key] = v
+			continue
+		}
+		for _, pair := range strings.Split(value, ",") {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			if v, err := strconv.ParseFloat(kv[1], 64); err == nil {
+				result[key+"."+kv[0]] = v
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,132 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/neocortical/newrelic"
+	"github.com/stretchr/testify/assert"
+)
+
+const testInfo = "# Server\r\nredis_version:7.2.0\r\n\r\n# Clients\r\nconnected_clients:3\r\nblocked_clients:0\r\n" +
+	"# Memory\r\nused_memory:1048576\r\n# Stats\r\nkeyspace_hits:%d\r\nkeyspace_misses:%d\r\nevicted_keys:2\r\n" +
+	"# Keyspace\r\ndb0:keys=5,expires=1,avg_ttl=0\r\ndb1:keys=2,expires=0,avg_ttl=0\r\n"
+
+// fakeServer answers AUTH and INFO like a Redis server. Each INFO reply adds
+// one hit and three misses to the keyspace counters.
+func fakeServer(t *testing.T, password string) (addr string, closeFn func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	hits, misses := 0, 0
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			for {
+				args, err := readCommand(r)
+				if err != nil {
+					break
+				}
+				switch strings.ToUpper(args[0]) {
+				case "AUTH":
+					if len(args) == 2 && args[1] == password {
+						conn.Write([]byte("+OK\r\n"))
+					} else {
+						conn.Write([]byte("-WRONGPASS invalid password\r\n"))
+					}
+				case "INFO":
+					info := fmt.Sprintf(testInfo, hits, misses)
+					hits, misses = hits+1, misses+3
+					fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(info), info)
+				}
+			}
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String(), func() { ln.Close() }
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	var n int
+	if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		var size int
+		if _, err := fmt.Fscanf(r, "$%d\r\n", &size); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func Test_ParseInfo(t *testing.T) {
+	values := ParseInfo(fmt.Sprintf(testInfo, 10, 20))
+	assert.Equal(t, 3.0, values["connected_clients"])
+	assert.Equal(t, 10.0, values["keyspace_hits"])
+	assert.Equal(t, 5.0, values["db0.keys"])
+	assert.Equal(t, 1.0, values["db0.expires"])
+	_, found := values["redis_version"]
+	assert.False(t, found)
+}
+
+func Test_Source(t *testing.T) {
+	addr, closeFn := fakeServer(t, "secret")
+	defer closeFn()
+
+	src := New(addr)
+	src.Password = "secret"
+	plugin := &newrelic.Plugin{Name: "Cache", GUID: "com.example.cache"}
+	plugin.AddSource(src)
+	client := newrelic.New("abc123")
+	client.AddPlugin(plugin)
+
+	request, err := client.GenerateRequest()
+	assert.Nil(t, err)
+	metrics := request.Plugins[0].Metrics
+	assert.Equal(t, 3.0, metrics["Component/Redis/Clients/Connected[clients]"])
+	assert.Equal(t, 1048576.0, metrics["Component/Redis/Memory/Used[bytes]"])
+	assert.Equal(t, 7.0, metrics["Component/Redis/Keys/Total[keys]"])
+	_, found := metrics["Component/Redis/Keyspace/Hits[hits/second]"]
+	assert.False(t, found)
+
+	// rates and the hit ratio need two polls
+	samples, err := src.PollSamples()
+	assert.Nil(t, err)
+	var ratio float64
+	for _, s := range samples {
+		if s.Name == "Redis/Keyspace/Hit Ratio" {
+			ratio = s.Value
+		}
+	}
+	assert.Equal(t, 25.0, ratio)
+}
+
+func Test_Source_errors(t *testing.T) {
+	addr, closeFn := fakeServer(t, "secret")
+	defer closeFn()
+
+	src := New(addr)
+	src.Password = "wrong"
+	_, err := src.PollSamples()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "WRONGPASS")
+
+	closeFn()
+	_, err = New(addr).PollSamples()
+	assert.NotNil(t, err)
+}
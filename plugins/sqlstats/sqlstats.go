@@ -0,0 +1,91 @@
+/*
+Package sqlstats reports database/sql connection pool statistics.
+
+	plugin, err := sqlstats.NewPlugin("Databases", "com.example.newrelic.databases",
+		map[string]*sql.DB{"orders": ordersDB, "users": usersDB})
+	client.AddPlugin(plugin)
+
+Open, in-use and idle connections are reported as gauges. The cumulative wait
+count, wait duration and closed connection counts are reported as deltas per
+poll interval.
+*/
+package sqlstats
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/neocortical/newrelic"
+)
+
+// NewPlugin creates a plugin reporting the stats of every named database
+func NewPlugin(name, guid string, dbs map[string]*sql.DB) (*newrelic.Plugin, error) {
+	p := &newrelic.Plugin{Name: name, GUID: guid}
+
+	names := make([]string, 0, len(dbs))
+	for dbName := range dbs {
+		names = append(names, dbName)
+	}
+	sort.Strings(names)
+
+	var err newrelic.CompositeError
+	for _, dbName := range names {
+		err = err.Accumulate(AddDB(p, dbName, dbs[dbName]))
+	}
+
+	if err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+// AddDB adds metrics for a database's pool stats to the plugin, named
+// Database/<name>/...
+func AddDB(p *newrelic.Plugin, name string, db *sql.DB) error {
+	if db == nil {
+		return fmt.Errorf("database %s is nil", name)
+	}
+	prefix := "Database/" + name + "/"
+
+	gauge := func(f func(sql.DBStats) int) func() (float64, error) {
+		return func() (float64, error) { return float64(f(db.Stats())), nil }
+	}
+	counter := func(f func(sql.DBStats) int64) func() (float64, error) {
+		return func() (float64, error) { return float64(f(db.Stats())), nil }
+	}
+
+	metrics := []newrelic.Metric{
+		newrelic.NewMetric(prefix+"Connections/Max Open", "connections",
+			gauge(func(s sql.DBStats) int { return s.MaxOpenConnections })),
+		newrelic.NewMetric(prefix+"Connections/Open", "connections",
+			gauge(func(s sql.DBStats) int { return s.OpenConnections })),
+		newrelic.NewMetric(prefix+"Connections/In Use", "connections",
+			gauge(func(s sql.DBStats) int { return s.InUse })),
+		newrelic.NewMetric(prefix+"Connections/Idle", "connections",
+			gauge(func(s sql.DBStats) int { return s.Idle })),
+
+		newrelic.NewDeltaMetric(prefix+"Wait/Count", "waits",
+			counter(func(s sql.DBStats) int64 { return s.WaitCount })),
+		newrelic.NewDeltaMetric(prefix+"Wait/Duration", "ms",
+			func() (float64, error) {
+				return float64(db.Stats().WaitDuration) / float64(time.Millisecond), nil
+			}),
+		newrelic.NewDeltaMetric(prefix+"Closed/Max Idle", "connections",
+			counter(func(s sql.DBStats) int64 { return s.MaxIdleClosed })),
+		newrelic.NewDeltaMetric(prefix+"Closed/Max Idle Time", "connections",
+			counter(func(s sql.DBStats) int64 { return s.MaxIdleTimeClosed })),
+		newrelic.NewDeltaMetric(prefix+"Closed/Max Lifetime", "connections",
+			counter(func(s sql.DBStats) int64 { return s.MaxLifetimeClosed })),
+	}
+
+	var err newrelic.CompositeError
+	for _, m := range metrics {
+		err = err.Accumulate(p.AddMetric(m))
+	}
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package sqlstats
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/neocortical/newrelic"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDriver opens connections that support nothing but being pooled
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+func init() {
+	sql.Register("sqlstatsfake", fakeDriver{})
+}
+
+func Test_NewPlugin(t *testing.T) {
+	db, err := sql.Open("sqlstatsfake", "")
+	assert.Nil(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(5)
+
+	plugin, err := NewPlugin("Databases", "com.example.databases", map[string]*sql.DB{"orders": db})
+	assert.Nil(t, err)
+	client := newrelic.New("abc123")
+	assert.Nil(t, client.AddPlugin(plugin))
+
+	conn, err := db.Conn(context.Background())
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	request, err := client.GenerateRequest()
+	assert.Nil(t, err)
+	metrics := request.Plugins[0].Metrics
+	assert.Equal(t, 5.0, metrics["Component/Database/orders/Connections/Max Open[connections]"])
+	assert.Equal(t, 1.0, metrics["Component/Database/orders/Connections/Open[connections]"])
+	assert.Equal(t, 1.0, metrics["Component/Database/orders/Connections/In Use[connections]"])
+	assert.Equal(t, 0.0, metrics["Component/Database/orders/Connections/Idle[connections]"])
+
+	// deltas report from the second poll on
+	_, found := metrics["Component/Database/orders/Wait/Count[waits]"]
+	assert.False(t, found)
+	request, err = client.GenerateRequest()
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, request.Plugins[0].Metrics["Component/Database/orders/Wait/Count[waits]"])
+}
+
+func Test_AddDB_invalid(t *testing.T) {
+	p := &newrelic.Plugin{Name: "Databases", GUID: "com.example.databases"}
+	assert.NotNil(t, AddDB(p, "orders", nil))
+
+	db, err := sql.Open("sqlstatsfake", "")
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Nil(t, AddDB(p, "orders", db))
+	assert.NotNil(t, AddDB(p, "orders", db))
+}
@@ -0,0 +1,84 @@
+package newrelic
+
+import (
+	"os"
+	"strings"
+)
+
+// naming carries the client settings applied to each plugin's metric names,
+// along with the clock its metrics are polled by
+type naming struct {
+	hostname string
+	prefix   string
+	labels   map[string]string
+	clock    Clock
+}
+
+func (c *Client) naming() naming {
+	return naming{
+		hostname: c.agent.Host,
+		prefix:   expandTemplate(c.MetricPrefix, c.agent.Host, c.Labels),
+		labels:   c.Labels,
+		clock:    c.clock(),
+	}
+}
+
+// expandTemplate expands $var and ${var} references in a metric name prefix
+// and sanitizes the result. Variables are looked up in each set of labels in
+// order, then "hostname" is the reporting host, then the environment.
+// Undefined variables expand to nothing and the empty segment is dropped.
+func expandTemplate(template, hostname string, labels ...map[string]string) string {
+	if template == "" {
+		return ""
+	}
+
+	expanded := os.Expand(template, func(name string) string {
+		for _, l := range labels {
+			if val, ok := l[name]; ok {
+				return val
+			}
+		}
+		if name == "hostname" {
+			if hostname == "" {
+				hostname, _ = os.Hostname()
+			}
+			return hostname
+		}
+		return os.Getenv(name)
+	})
+	return SanitizeMetricName(expanded)
+}
+
+func joinPrefix(prefixes ...string) string {
+	kept := make([]string, 0, len(prefixes))
+	for _, p := range prefixes {
+		if p != "" {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, "/")
+}
+
+// prefixMetricKey inserts a prefix into a metric key after "Component/". The
+// name is truncated if the prefix makes the key longer than
+// MaxMetricKeyLength.
+func prefixMetricKey(key, prefix string) string {
+	if prefix == "" {
+		return key
+	}
+	key = "Component/" + prefix + "/" + strings.TrimPrefix(key, "Component/")
+	if len(key) <= MaxMetricKeyLength {
+		return key
+	}
+
+	i := strings.LastIndexByte(key, '[')
+	if i < 0 || !strings.HasSuffix(key, "]") {
+		return key
+	}
+	name, units := strings.TrimPrefix(key[:i], "Component/"), key[i+1:len(key)-1]
+	max := MaxMetricKeyLength - len(metricKey("", units))
+	if max < 1 {
+		return key
+	}
+	return metricKey(strings.TrimRight(truncate(name, max), "/"), units)
+}
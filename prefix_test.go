@@ -0,0 +1,100 @@
+package newrelic
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neocortical/newrelic/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_expandTemplate(t *testing.T) {
+	os.Setenv("NEWRELIC_TEST_CLUSTER", "east")
+	defer os.Unsetenv("NEWRELIC_TEST_CLUSTER")
+
+	labels := map[string]string{"env": "prod", "shard": "7"}
+	override := map[string]string{"env": "staging"}
+
+	assert.Equal(t, "", expandTemplate("", "host1", labels))
+	assert.Equal(t, "Static", expandTemplate("Static", "host1"))
+	assert.Equal(t, "Cluster/east/prod", expandTemplate("Cluster/${NEWRELIC_TEST_CLUSTER}/$env", "host1", labels))
+	assert.Equal(t, "staging/7", expandTemplate("${env}/${shard}", "host1", override, labels))
+	assert.Equal(t, "Host/host1", expandTemplate("Host/${hostname}", "host1"))
+	assert.Equal(t, "Host/host1", expandTemplate("Host/${hostname}", "ignored", map[string]string{"hostname": "host1"}))
+
+	// undefined variables leave no empty segments and values are sanitized
+	assert.Equal(t, "Cluster/Queue", expandTemplate("/Cluster/${NEWRELIC_TEST_UNDEFINED}/Queue", "host1"))
+	assert.Equal(t, "Pod/web(1)", expandTemplate("Pod/${pod}", "host1", map[string]string{"pod": "web[1]"}))
+
+	host, _ := os.Hostname()
+	assert.Equal(t, "Host/"+SanitizeMetricName(host), expandTemplate("Host/${hostname}", ""))
+}
+
+func Test_prefixMetricKey(t *testing.T) {
+	assert.Equal(t, "Component/foo[bars]", prefixMetricKey("Component/foo[bars]", ""))
+	assert.Equal(t, "Component/A/B/foo[bars]", prefixMetricKey("Component/foo[bars]", "A/B"))
+	assert.Equal(t, "A/B", joinPrefix("", "A", "", "B"))
+}
+
+func Test_generateRequest_metricPrefixes(t *testing.T) {
+	p1 := &Plugin{
+		Name:         "Queue",
+		GUID:         "com.example.queue",
+		MetricPrefix: "Queue/$queue",
+		Labels:       map[string]string{"queue": "jobs"},
+	}
+	p1.AddMetric(NewMetric("Depth", "messages", func() (float64, error) { return 3, nil }))
+	p2 := &Plugin{Name: "Plain", GUID: "com.example.plain"}
+	p2.AddMetric(NewMetric("Depth", "messages", func() (float64, error) { return 4, nil }))
+
+	c := &Client{
+		PollInterval: time.Minute,
+		Plugins:      []*Plugin{p1, p2},
+		MetricPrefix: "Cluster/${cluster}",
+		Labels:       map[string]string{"cluster": "east", "queue": "ignored"},
+		agent:        model.Agent{Host: "10.0.0.1"},
+	}
+
+	request, err := c.generateRequest(time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"Component/Cluster/east/Queue/jobs/Depth[messages]": 3.0}, request.Plugins[0].Metrics)
+	assert.Equal(t, map[string]interface{}{"Component/Cluster/east/Depth[messages]": 4.0}, request.Plugins[1].Metrics)
+
+	// plugin prefixes fall back to client labels and the agent host
+	c.clearState()
+	p1.Labels = nil
+	p1.MetricPrefix = "$queue/$hostname"
+	c.MetricPrefix = ""
+	request, err = c.generateRequest(time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"Component/ignored/10.0.0.1/Depth[messages]": 3.0}, request.Plugins[0].Metrics)
+}
+
+func Test_prefixMetricKey_truncates(t *testing.T) {
+	key := prefixMetricKey("Component/"+strings.Repeat("a", 200)+"[bars]", strings.Repeat("P", 60))
+	assert.Equal(t, MaxMetricKeyLength, len(key))
+	assert.True(t, strings.HasPrefix(key, "Component/"+strings.Repeat("P", 60)+"/a"))
+	assert.True(t, strings.HasSuffix(key, "a[bars]"))
+
+	// a truncated name doesn't end in a slash
+	key = prefixMetricKey("Component/"+strings.Repeat("a", 177)+"/bbbbbbbb[bars]", strings.Repeat("P", 60))
+	assert.Equal(t, "Component/"+strings.Repeat("P", 60)+"/"+strings.Repeat("a", 177)+"[bars]", key)
+}
+
+func Test_generateRequest_longPrefix(t *testing.T) {
+	p := &Plugin{Name: "Queue", GUID: "com.example.queue", MetricPrefix: "$queue"}
+	p.AddMetric(NewMetric(strings.Repeat("a", 200), "messages", func() (float64, error) { return 3, nil }))
+
+	c := &Client{
+		PollInterval: time.Minute,
+		Plugins:      []*Plugin{p},
+		Labels:       map[string]string{"queue": strings.Repeat("q", 100)},
+		agent:        model.Agent{Host: "10.0.0.1", Version: "1.0.0"},
+	}
+	request, err := c.generateRequest(time.Now())
+	assert.Nil(t, err)
+	assert.Nil(t, ValidateRequest(request))
+	assert.Equal(t, 1, len(request.Plugins[0].Metrics))
+}
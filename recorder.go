@@ -0,0 +1,155 @@
+package newrelic
+
+import (
+	"sync"
+	"time"
+
+	"github.com/neocortical/newrelic/model"
+)
+
+// AggregateMetric is implemented by metrics that collect many samples between
+// polls. Plugins call PollAggregate instead of Poll and merge the result into
+// the metric's state, so min/max/count reflect every sample. Samples returned
+// along with an error are still reported.
+type AggregateMetric interface {
+	Metric
+	PollAggregate() (model.MetricValue, error)
+}
+
+// Counter is a Metric that reports the amount added since it was last polled
+type Counter struct {
+	name  string
+	units string
+
+	mu    sync.Mutex
+	value float64
+}
+
+// NewCounter creates a new Counter
+func NewCounter(name, units string) *Counter {
+	return &Counter{name: name, units: units}
+}
+
+// Add n to the counter
+func (c *Counter) Add(n float64) {
+	c.mu.Lock()
+	c.value += n
+	c.mu.Unlock()
+}
+
+// Inc adds one to the counter
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Name implements Metric
+func (c *Counter) Name() string { return c.name }
+
+// Units implements Metric
+func (c *Counter) Units() string { return c.units }
+
+// Poll returns the amount added since the last poll and resets the counter
+func (c *Counter) Poll() (float64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	val := c.value
+	c.value = 0
+	return val, nil
+}
+
+// Recorder is an AggregateMetric that reports every value recorded since it
+// was last polled, e.g. the latency of each request
+type Recorder struct {
+	name  string
+	units string
+
+	mu    sync.Mutex
+	state model.MetricValue
+}
+
+// NewRecorder creates a new Recorder
+func NewRecorder(name, units string) *Recorder {
+	return &Recorder{name: name, units: units}
+}
+
+// Record a single value
+func (r *Recorder) Record(val float64) {
+	r.mu.Lock()
+	r.state = updateState(r.state, val)
+	r.mu.Unlock()
+}
+
+// RecordDuration records d in milliseconds
+func (r *Recorder) RecordDuration(d time.Duration) {
+	r.Record(float64(d) / float64(time.Millisecond))
+}
+
+// Name implements Metric
+func (r *Recorder) Name() string { return r.name }
+
+// Units implements Metric
+func (r *Recorder) Units() string { return r.units }
+
+// Poll returns the mean of the values recorded since the last poll and resets
+// the recorder. Plugins use PollAggregate instead.
+func (r *Recorder) Poll() (float64, error) {
+	state, _ := r.PollAggregate()
+	if state.Count == 0 {
+		return 0, nil
+	}
+	return state.Total / float64(state.Count), nil
+}
+
+// PollAggregate returns the values recorded since the last poll and resets
+// the recorder
+func (r *Recorder) PollAggregate() (model.MetricValue, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state := r.state
+	r.state = model.MetricValue{}
+	return state, nil
+}
+
+// mergedMetric polls several metrics sharing one key and combines their
+// samples into a single aggregate
+type mergedMetric struct {
+	metrics []Metric
+}
+
+func mergeMetrics(existing, metric Metric) Metric {
+	if mm, ok := existing.(*mergedMetric); ok {
+		mm.metrics = append(mm.metrics, metric)
+		return mm
+	}
+	return &mergedMetric{metrics: []Metric{existing, metric}}
+}
+
+func (mm *mergedMetric) setClock(clock Clock) {
+	for _, m := range mm.metrics {
+		setClock(m, clock)
+	}
+}
+
+func (mm *mergedMetric) Name() string  { return mm.metrics[0].Name() }
+func (mm *mergedMetric) Units() string { return mm.metrics[0].Units() }
+
+func (mm *mergedMetric) Poll() (float64, error) {
+	state, err := mm.PollAggregate()
+	return state.Total, err
+}
+
+// PollAggregate polls every metric. The samples of those that succeed are
+// returned along with the errors of those that fail, since polling has already
+// taken them from counters and recorders.
+func (mm *mergedMetric) PollAggregate() (result model.MetricValue, err error) {
+	var cerr CompositeError
+	for _, m := range mm.metrics {
+		val, perr := pollSamples(m)
+		result = mergeState(result, val)
+		cerr = cerr.Accumulate(perr)
+	}
+	if cerr != nil {
+		return result, cerr
+	}
+	return result, nil
+}
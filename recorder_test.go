@@ -0,0 +1,95 @@
+package newrelic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/neocortical/newrelic/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Counter(t *testing.T) {
+	c := NewCounter("Requests", "requests")
+	assert.Equal(t, "Requests", c.Name())
+	assert.Equal(t, "requests", c.Units())
+
+	c.Inc()
+	c.Add(4)
+	val, err := c.Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, 5.0, val)
+
+	val, err = c.Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, val)
+}
+
+func Test_Recorder(t *testing.T) {
+	r := NewRecorder("Latency", "ms")
+	assert.Equal(t, "Latency", r.Name())
+	assert.Equal(t, "ms", r.Units())
+
+	r.Record(2)
+	r.RecordDuration(4 * time.Millisecond)
+	val, err := r.PollAggregate()
+	assert.Nil(t, err)
+	assert.Equal(t, model.MetricValue{Min: 2, Max: 4, Total: 6, Count: 2, SumOfSquares: 20}, val)
+
+	val, err = r.PollAggregate()
+	assert.Nil(t, err)
+	assert.Equal(t, model.MetricValue{}, val)
+
+	r.Record(3)
+	r.Record(5)
+	mean, err := r.Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, 4.0, mean)
+
+	mean, err = r.Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, mean)
+}
+
+func Test_generateMetricSnapshot_aggregate(t *testing.T) {
+	r := NewRecorder("Latency", "ms")
+	sm := &statefulMetric{metric: r}
+
+	// no samples, nothing to report
+	result, err := sm.generateMetricSnapshot()
+	assert.Nil(t, err)
+	assert.Nil(t, result)
+
+	r.Record(7)
+	result, err = sm.generateMetricSnapshot()
+	assert.Nil(t, err)
+	assert.Equal(t, 7.0, result)
+
+	// unsent state is merged with new samples
+	r.Record(1)
+	r.Record(4)
+	result, err = sm.generateMetricSnapshot()
+	assert.Nil(t, err)
+	assert.Equal(t, model.MetricValue{Min: 1, Max: 7, Total: 12, Count: 3, SumOfSquares: 66}, result)
+}
+
+func Test_generatePluginSnapshot_skipsEmptyAggregates(t *testing.T) {
+	p := &Plugin{Name: "foo", GUID: "com.example.foo"}
+	p.AddMetric(NewRecorder("Latency", "ms"))
+	counter := NewCounter("Requests", "requests")
+	p.AddMetric(counter)
+	counter.Inc()
+
+	snapshot, err := p.generatePluginSnapshot(time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"Component/Requests[requests]": 1.0}, snapshot.Metrics)
+}
+
+func Test_mergeState(t *testing.T) {
+	empty := model.MetricValue{}
+	a := model.MetricValue{Min: 1, Max: 3, Total: 4, Count: 2, SumOfSquares: 10}
+	b := model.MetricValue{Min: 0, Max: 2, Total: 2, Count: 2, SumOfSquares: 4}
+
+	assert.Equal(t, a, mergeState(a, empty))
+	assert.Equal(t, a, mergeState(empty, a))
+	assert.Equal(t, model.MetricValue{Min: 0, Max: 3, Total: 6, Count: 4, SumOfSquares: 14}, mergeState(a, b))
+}
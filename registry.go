@@ -0,0 +1,51 @@
+package newrelic
+
+import (
+	"os"
+	"sync"
+)
+
+// LicenseEnv is the environment variable the default client takes its license
+// from
+const LicenseEnv = "NEWRELIC_LICENSE"
+
+var (
+	defaultOnce   sync.Once
+	defaultClient *Client
+	defaultErr    error
+)
+
+// DefaultClient returns the client shared by the whole process, creating it
+// with the license in LicenseEnv on first use. If that fails, because the host
+// name can't be determined, every call returns the error. Libraries add their
+// plugins to it with Register, and the application configures it and calls
+// Run, so that every plugin in the process is reported in a single request per
+// poll interval:
+//
+//	// in a library
+//	newrelic.Register(&newrelic.Plugin{Name: "Cache", GUID: "com.example.newrelic.cache"})
+//
+//	// in main
+//	client, err := newrelic.DefaultClient()
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	client.License = license
+//	client.Run()
+func DefaultClient() (*Client, error) {
+	defaultOnce.Do(func() {
+		defaultClient, defaultErr = NewClient(os.Getenv(LicenseEnv))
+	})
+	return defaultClient, defaultErr
+}
+
+// Register adds a plugin to the default client. It is safe to call from
+// several goroutines and after the default client has started. It returns the
+// error from creating the default client, if any.
+func Register(p *Plugin) error {
+	c, err := DefaultClient()
+	if err != nil {
+		return err
+	}
+	return c.AddPlugin(p)
+}
@@ -0,0 +1,107 @@
+package newrelic
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neocortical/newrelic/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func resetDefaultClient() {
+	defaultOnce = sync.Once{}
+	defaultClient = nil
+	defaultErr = nil
+}
+
+func Test_DefaultClient(t *testing.T) {
+	resetDefaultClient()
+	defer resetDefaultClient()
+	os.Setenv(LicenseEnv, "fromenv")
+	defer os.Unsetenv(LicenseEnv)
+
+	c, err := DefaultClient()
+	assert.Nil(t, err)
+	assert.Equal(t, "fromenv", c.License)
+	again, _ := DefaultClient()
+	assert.True(t, c == again)
+}
+
+func Test_DefaultClient_error(t *testing.T) {
+	resetDefaultClient()
+	defer resetDefaultClient()
+	defaultOnce.Do(func() { defaultErr = errors.New("error getting host name") })
+
+	c, err := DefaultClient()
+	assert.Nil(t, c)
+	assert.NotNil(t, err)
+	assert.Equal(t, err, Register(&Plugin{Name: "Cache", GUID: "com.example.Cache"}))
+}
+
+func Test_Register(t *testing.T) {
+	resetDefaultClient()
+	defer resetDefaultClient()
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"Cache", "Queue", "Database"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			p := &Plugin{Name: name, GUID: "com.example." + name}
+			p.AddMetric(NewMetric("Count", "things", func() (float64, error) { return 1, nil }))
+			assert.Nil(t, Register(p))
+		}(name)
+	}
+	c, err := DefaultClient()
+	assert.Nil(t, err)
+	go c.GenerateRequest()
+	wg.Wait()
+
+	request, err := c.GenerateRequest()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(request.Plugins))
+
+	assert.NotNil(t, Register(&Plugin{Name: "Cache", GUID: "com.example.Cache"}))
+}
+
+func Test_Run_once(t *testing.T) {
+	mc := NewManualClock(time.Date(2016, 1, 1, 10, 0, 0, 0, time.UTC))
+
+	requests := make(chan model.Request, 10)
+	testSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var req model.Request
+		json.NewDecoder(r.Body).Decode(&req)
+		requests <- req
+	}))
+	defer testSvr.Close()
+
+	c := New("abc123")
+	c.Clock = mc
+	c.URL = testSvr.URL
+	c.HTTPClient = &http.Client{}
+	c.AddPlugin(testPlugin())
+	c.Run()
+	c.Run()
+
+	waitForWaiter(t, mc)
+	mc.Advance(time.Minute)
+	<-requests
+
+	// a plugin added while running is included in the next report
+	assert.Nil(t, c.AddPlugin(&Plugin{Name: "Late", GUID: "com.example.late"}))
+	waitForWaiter(t, mc)
+	mc.Advance(time.Minute)
+	assert.Equal(t, 2, len((<-requests).Plugins))
+
+	select {
+	case <-requests:
+		t.Fatal("client was started twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
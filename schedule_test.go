@@ -0,0 +1,140 @@
+package newrelic
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/neocortical/newrelic/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_firstCycle(t *testing.T) {
+	now := time.Date(2016, 1, 1, 10, 0, 20, 0, time.UTC)
+	c := &Client{PollInterval: time.Minute}
+
+	assert.Equal(t, now.Add(time.Minute), c.firstCycle(now))
+
+	c.AlignCycles = true
+	assert.Equal(t, time.Date(2016, 1, 1, 10, 1, 0, 0, time.UTC), c.firstCycle(now))
+
+	saved := randInt63n
+	defer func() { randInt63n = saved }()
+	var jitterMax int64
+	randInt63n = func(n int64) int64 {
+		jitterMax = n
+		return int64(7 * time.Second)
+	}
+	c.StartJitter = 15 * time.Second
+	assert.Equal(t, time.Date(2016, 1, 1, 10, 1, 7, 0, time.UTC), c.firstCycle(now))
+	assert.Equal(t, int64(15*time.Second), jitterMax)
+}
+
+func Test_run_alignedCyclesAndOverruns(t *testing.T) {
+	t0 := time.Date(2016, 1, 1, 10, 0, 20, 0, time.UTC)
+	mc := NewManualClock(t0)
+
+	var slow int32
+	requests := make(chan model.Request, 10)
+	testSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var req model.Request
+		json.NewDecoder(r.Body).Decode(&req)
+		if atomic.LoadInt32(&slow) == 1 {
+			// sending takes two and a half intervals
+			mc.Advance(2*time.Minute + 30*time.Second)
+		}
+		requests <- req
+	}))
+	defer testSvr.Close()
+
+	c := New("abc123")
+	c.Clock = mc
+	c.AlignCycles = true
+	c.URL = testSvr.URL
+	c.HTTPClient = &http.Client{}
+	c.AddPlugin(testPlugin())
+	c.Run()
+
+	// first cycle is on the minute and only covers the time since Run
+	waitForWaiter(t, mc)
+	mc.Advance(40 * time.Second)
+	assert.Equal(t, 40, (<-requests).Plugins[0].DurationSec)
+	assert.Equal(t, int64(0), c.Overruns())
+
+	atomic.StoreInt32(&slow, 1)
+	waitForWaiter(t, mc)
+	mc.Advance(time.Minute)
+	assert.Equal(t, 60, (<-requests).Plugins[0].DurationSec)
+	atomic.StoreInt32(&slow, 0)
+
+	// the 10:03 and 10:04 cycles were missed, the next one is at 10:05
+	waitForWaiter(t, mc)
+	assert.Equal(t, int64(2), c.Overruns())
+	mc.Advance(30 * time.Second)
+	assert.Equal(t, time.Date(2016, 1, 1, 10, 5, 0, 0, time.UTC), mc.Now())
+	assert.Equal(t, 180, (<-requests).Plugins[0].DurationSec)
+}
+
+func Test_Flush_neverConcurrent(t *testing.T) {
+	var active, maxActive int32
+	testSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&active, 1)
+		if n > atomic.LoadInt32(&maxActive) {
+			atomic.StoreInt32(&maxActive, n)
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&active, -1)
+	}))
+	defer testSvr.Close()
+
+	c := New("abc123")
+	c.URL = testSvr.URL
+	c.HTTPClient = &http.Client{}
+	c.AddPlugin(testPlugin())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Tick()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), maxActive)
+}
+
+func Test_run_zeroPollInterval(t *testing.T) {
+	t0 := time.Date(2016, 1, 1, 10, 0, 0, 0, time.UTC)
+	mc := NewManualClock(t0)
+
+	requests := make(chan model.Request, 10)
+	testSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var req model.Request
+		json.NewDecoder(r.Body).Decode(&req)
+		requests <- req
+	}))
+	defer testSvr.Close()
+
+	c := New("abc123")
+	c.PollInterval = 0
+	c.Clock = mc
+	c.AlignCycles = true
+	c.URL = testSvr.URL
+	c.HTTPClient = &http.Client{}
+	c.AddPlugin(testPlugin())
+	c.Run()
+
+	// the default interval is used instead
+	waitForWaiter(t, mc)
+	mc.Advance(DefaultPollInterval)
+	assert.Equal(t, 60, (<-requests).Plugins[0].DurationSec)
+
+	waitForWaiter(t, mc)
+	mc.Advance(DefaultPollInterval)
+	assert.Equal(t, 60, (<-requests).Plugins[0].DurationSec)
+}
@@ -0,0 +1,149 @@
+package newrelic
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/neocortical/newrelic/model"
+)
+
+// KindCount marks a sample whose value counts events since the previous poll,
+// such as requests served. It is reported as is, but as a count rather than a
+// gauge to the Metric API.
+const KindCount = "count"
+
+// Sample is a single value polled from a Source
+type Sample struct {
+	Name  string
+	Units string
+	Value float64
+
+	// Kind is KindGauge (the default), KindCount, KindDelta or KindRate
+	Kind string
+
+	// Aggregate, if its Count is non-zero, holds several values recorded
+	// since the previous poll, such as request latencies, and Value is
+	// ignored. Aggregates are always gauges.
+	Aggregate model.MetricValue
+}
+
+// Source polls a set of metrics that may not be known in advance, such as the
+// output of an external command or a server's stats page. Each poll returns
+// the current samples; a metric missing from a poll is not reported for that
+// cycle, unless samples from earlier polls have yet to be sent. Samples
+// returned along with an error are still reported.
+type Source interface {
+	PollSamples() ([]Sample, error)
+}
+
+// SourceFunc adapts a function to the Source interface
+type SourceFunc func() ([]Sample, error)
+
+// PollSamples calls f
+func (f SourceFunc) PollSamples() ([]Sample, error) { return f() }
+
+// sourceState tracks the metrics seen so far from a source. Their names are
+// sanitized, since they usually come from outside the program.
+type sourceState struct {
+	source  Source
+	metrics map[string]*statefulMetric
+
+	// latest holds the samples from the current poll
+	latest map[string]Sample
+}
+
+// AddSource adds a source of metrics to the plugin. Samples with the same key
+// as a metric added with AddMetric are rejected, and those with the same key
+// as another source's are resolved by the plugin's OnConflict. It is safe to
+// add sources while the plugin is reporting.
+func (p *Plugin) AddSource(s Source) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sources = append(p.sources, &sourceState{
+		source:  s,
+		metrics: make(map[string]*statefulMetric),
+	})
+}
+
+// poll polls the source and returns the keys of the metrics it reported
+func (s *sourceState) poll(p *Plugin) (keys []string, err CompositeError) {
+	samples, serr := s.source.PollSamples()
+	err = err.Accumulate(serr)
+
+	s.latest = make(map[string]Sample)
+	for _, sample := range samples {
+		if SanitizeMetricName(sample.Name) == "" {
+			err = err.Accumulate(fmt.Errorf("sample name %q is empty after sanitizing", sample.Name))
+			continue
+		}
+		key := sanitizeMetricKey(sample.Name, sample.Units)
+		if _, ok := p.metrics[key]; ok {
+			err = err.Accumulate(fmt.Errorf("sample %s conflicts with a metric on plugin %s", key, p.Name))
+			continue
+		}
+
+		if _, ok := s.metrics[key]; !ok {
+			metric, merr := s.newMetric(key, sample)
+			if merr != nil {
+				err = err.Accumulate(merr)
+				continue
+			}
+			s.metrics[key] = &statefulMetric{metric: metric}
+		}
+		s.latest[key] = sample
+	}
+
+	for key := range s.latest {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, err
+}
+
+// newMetric creates the metric for a sample's key. It reads the key's sample
+// from the current poll.
+func (s *sourceState) newMetric(key string, sample Sample) (Metric, error) {
+	pollFn := func() (float64, error) { return s.latest[key].Value, nil }
+
+	switch sample.Kind {
+	case "", KindGauge, KindCount:
+		return &sourceMetric{
+			name:   sample.Name,
+			units:  sample.Units,
+			count:  sample.Kind == KindCount,
+			sample: func() Sample { return s.latest[key] },
+		}, nil
+	case KindDelta:
+		return NewDeltaMetric(sample.Name, sample.Units, pollFn), nil
+	case KindRate:
+		return NewRateMetric(sample.Name, sample.Units, pollFn), nil
+	}
+	return nil, fmt.Errorf("sample %s has unknown metric kind %q", sample.Name, sample.Kind)
+}
+
+// sourceMetric reports a source's gauge, count or aggregate samples. It is a
+// summary to the Metric API once it has reported an aggregate.
+type sourceMetric struct {
+	name      string
+	units     string
+	count     bool
+	aggregate bool
+	sample    func() Sample
+}
+
+func (sm *sourceMetric) Name() string  { return sm.name }
+func (sm *sourceMetric) Units() string { return sm.units }
+
+func (sm *sourceMetric) Poll() (float64, error) {
+	return sm.sample().Value, nil
+}
+
+func (sm *sourceMetric) PollAggregate() (model.MetricValue, error) {
+	sample := sm.sample()
+	if sample.Aggregate.Count != 0 {
+		sm.aggregate = true
+		return sample.Aggregate, nil
+	}
+	v := sample.Value
+	return model.MetricValue{Min: v, Max: v, Total: v, Count: 1, SumOfSquares: v * v}, nil
+}
@@ -0,0 +1,151 @@
+package newrelic
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/neocortical/newrelic/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Plugin_AddSource(t *testing.T) {
+	var samples []Sample
+	var pollErr error
+	p := &Plugin{Name: "MyPlugin", GUID: "com.example.myplugin", Stale: StaleLastValue}
+	p.AddMetric(NewMetric("Static", "values", func() (float64, error) { return 1, nil }))
+	p.AddSource(SourceFunc(func() ([]Sample, error) { return samples, pollErr }))
+
+	samples = []Sample{
+		{Name: "Queue/Depth", Units: "messages", Value: 3},
+		{Name: "Queue/Processed", Units: "messages", Value: 10, Kind: KindDelta},
+		{Name: "Queue[1]", Units: "", Value: 4},
+	}
+	snapshot, err := p.generatePluginSnapshot(time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"Component/Static[values]":        1.0,
+		"Component/Queue/Depth[messages]": 3.0,
+		"Component/Queue(1)[value]":       4.0,
+	}, snapshot.Metrics)
+	p.clearState()
+
+	// missing samples are not reported, deltas are taken between polls
+	samples = []Sample{{Name: "Queue/Processed", Units: "messages", Value: 15, Kind: KindDelta}}
+	snapshot, err = p.generatePluginSnapshot(time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"Component/Static[values]":            1.0,
+		"Component/Queue/Processed[messages]": 5.0,
+	}, snapshot.Metrics)
+	p.clearState()
+
+	// a failed source reports stale values for all of its metrics
+	samples, pollErr = nil, errors.New("boom")
+	snapshot, err = p.generatePluginSnapshot(time.Minute)
+	assert.NotNil(t, err)
+	assert.Equal(t, 3.0, snapshot.Metrics["Component/Queue/Depth[messages]"])
+	assert.Equal(t, 5.0, snapshot.Metrics["Component/Queue/Processed[messages]"])
+	assert.Equal(t, int64(1), p.ErrorCounts()["Component/Queue/Depth[messages]"])
+}
+
+func Test_Plugin_AddSource_invalidSamples(t *testing.T) {
+	p := &Plugin{Name: "MyPlugin", GUID: "com.example.myplugin"}
+	p.AddMetric(NewMetric("Static", "values", func() (float64, error) { return 1, nil }))
+	p.AddSource(SourceFunc(func() ([]Sample, error) {
+		return []Sample{
+			{Name: "Static", Units: "values", Value: 2},
+			{Name: "//", Units: "values", Value: 2},
+			{Name: "Rate", Units: "values", Value: 2, Kind: "average"},
+			{Name: "Good", Units: "values", Value: 2},
+		}, nil
+	}))
+
+	snapshot, err := p.generatePluginSnapshot(time.Minute)
+	assert.Equal(t, 3, len(err))
+	assert.Equal(t, map[string]interface{}{
+		"Component/Static[values]": 1.0,
+		"Component/Good[values]":   2.0,
+	}, snapshot.Metrics)
+}
+
+func Test_Plugin_AddSource_countsAndAggregates(t *testing.T) {
+	p := &Plugin{Name: "MyPlugin", GUID: "com.example.myplugin"}
+	p.AddSource(SourceFunc(func() ([]Sample, error) {
+		return []Sample{
+			{Name: "Requests", Units: "requests", Value: 4, Kind: KindCount},
+			{Name: "Latency", Units: "ms", Aggregate: model.MetricValue{Min: 1, Max: 3, Total: 4, Count: 2, SumOfSquares: 10}},
+		}, nil
+	}))
+
+	snapshot, err := p.generatePluginSnapshot(time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"Component/Requests[requests]": 4.0,
+		"Component/Latency[ms]":        model.MetricValue{Min: 1, Max: 3, Total: 4, Count: 2, SumOfSquares: 10},
+	}, snapshot.Metrics)
+	assert.Equal(t, map[string]dimensionalSample{
+		"Component/Requests[requests]": {value: model.MetricValue{Min: 4, Max: 4, Total: 4, Count: 1, SumOfSquares: 16}, typ: model.MetricTypeCount},
+		"Component/Latency[ms]":        {value: model.MetricValue{Min: 1, Max: 3, Total: 4, Count: 2, SumOfSquares: 10}, typ: model.MetricTypeSummary},
+	}, p.dimensional)
+}
+
+func Test_Plugin_AddSource_conflicts(t *testing.T) {
+	newPlugin := func(policy ConflictPolicy) *Plugin {
+		p := &Plugin{Name: "MyPlugin", GUID: "com.example.myplugin", OnConflict: policy}
+		p.AddSource(SourceFunc(func() ([]Sample, error) {
+			return []Sample{{Name: "Requests", Units: "requests", Value: 2, Kind: KindCount}}, nil
+		}))
+		p.AddSource(SourceFunc(func() ([]Sample, error) {
+			return []Sample{{Name: "Requests", Units: "requests", Value: 3, Kind: KindCount}}, nil
+		}))
+		return p
+	}
+	key := "Component/Requests[requests]"
+
+	p := newPlugin(ConflictReject)
+	snapshot, err := p.generatePluginSnapshot(time.Minute)
+	assert.Equal(t, 1, len(err))
+	assert.Equal(t, 2.0, snapshot.Metrics[key])
+	assert.Equal(t, 2.0, p.dimensional[key].value.Total)
+
+	p = newPlugin(ConflictReplace)
+	snapshot, err = p.generatePluginSnapshot(time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 3.0, snapshot.Metrics[key])
+	assert.Equal(t, 3.0, p.dimensional[key].value.Total)
+
+	p = newPlugin(ConflictMerge)
+	snapshot, err = p.generatePluginSnapshot(time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, model.MetricValue{Min: 2, Max: 3, Total: 5, Count: 2, SumOfSquares: 13}, snapshot.Metrics[key])
+	assert.Equal(t, 5.0, p.dimensional[key].value.Total)
+
+	// the state of every source is cleared
+	p.clearState()
+	p.clearDimensionalState()
+	p.eachMetric(func(_ string, m *statefulMetric) {
+		assert.Equal(t, model.MetricValue{}, m.state)
+		assert.Equal(t, model.MetricValue{}, m.dimState)
+	})
+}
+
+func Test_Plugin_AddSource_whileReporting(t *testing.T) {
+	p := &Plugin{Name: "MyPlugin", GUID: "com.example.myplugin"}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			p.generatePluginSnapshot(time.Minute)
+			p.ErrorCounts()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("Source%d", i)
+		p.AddSource(SourceFunc(func() ([]Sample, error) {
+			return []Sample{{Name: name, Units: "values", Value: 1}}, nil
+		}))
+	}
+	<-done
+}
@@ -0,0 +1,134 @@
+package newrelic
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+)
+
+// Metric kinds accepted in struct tags by RegisterStruct
+const (
+	// KindGauge reports a field's current value
+	KindGauge = "gauge"
+	// KindDelta reports how much a cumulative field grew since the last poll
+	KindDelta = "delta"
+	// KindRate reports the per-second rate of change of a cumulative field
+	KindRate = "rate"
+)
+
+var (
+	atomicInt32Type  = reflect.TypeOf(atomic.Int32{})
+	atomicInt64Type  = reflect.TypeOf(atomic.Int64{})
+	atomicUint32Type = reflect.TypeOf(atomic.Uint32{})
+	atomicUint64Type = reflect.TypeOf(atomic.Uint64{})
+)
+
+// RegisterStruct adds a metric to the plugin for every field of the struct
+// pointed to by v that has a newrelic tag. The tag holds the metric name,
+// units and kind, of which only the name is required:
+//
+//	type Stats struct {
+//		Requests atomic.Int64 `newrelic:"Requests/Total,requests,rate"`
+//		Errors   atomic.Int64 `newrelic:"Requests/Errors,errors,delta"`
+//		Queued   int          `newrelic:"Queue/Depth,messages"`
+//	}
+//
+//	err := newrelic.RegisterStruct(plugin, &stats)
+//
+// Units default to "value" and kind to KindGauge. Tagged fields must be
+// exported numbers or atomic.Int32, atomic.Int64, atomic.Uint32 or
+// atomic.Uint64. Plain numeric fields are read without synchronization, so
+// fields updated concurrently should use the atomic types. Errors for every
+// invalid field are returned together; valid fields are still registered.
+func RegisterStruct(p *Plugin, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("RegisterStruct requires a non-nil pointer to a struct, got %T", v)
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+
+	var err CompositeError
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag, ok := field.Tag.Lookup("newrelic")
+		if !ok || tag == "-" {
+			continue
+		}
+		err = err.Accumulate(registerField(p, field, rv.Field(i), tag))
+	}
+
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func registerField(p *Plugin, field reflect.StructField, fv reflect.Value, tag string) error {
+	if field.PkgPath != "" {
+		return fmt.Errorf("field %s is unexported", field.Name)
+	}
+
+	parts := strings.Split(tag, ",")
+	name, units, kind := parts[0], defaultUnits, KindGauge
+	if len(parts) > 1 && parts[1] != "" {
+		units = parts[1]
+	}
+	if len(parts) > 2 && parts[2] != "" {
+		kind = parts[2]
+	}
+	if len(parts) > 3 {
+		return fmt.Errorf("field %s has malformed newrelic tag %q", field.Name, tag)
+	}
+
+	read, err := fieldReader(fv)
+	if err != nil {
+		return fmt.Errorf("field %s: %v", field.Name, err)
+	}
+	pollFn := func() (float64, error) { return read(), nil }
+
+	var metric Metric
+	switch kind {
+	case KindGauge:
+		metric = NewMetric(name, units, pollFn)
+	case KindDelta:
+		metric = NewDeltaMetric(name, units, pollFn)
+	case KindRate:
+		metric = NewRateMetric(name, units, pollFn)
+	default:
+		return fmt.Errorf("field %s has unknown metric kind %q", field.Name, kind)
+	}
+
+	if err := p.AddMetric(metric); err != nil {
+		return fmt.Errorf("field %s: %v", field.Name, err)
+	}
+	return nil
+}
+
+func fieldReader(fv reflect.Value) (func() float64, error) {
+	switch fv.Type() {
+	case atomicInt32Type:
+		a := fv.Addr().Interface().(*atomic.Int32)
+		return func() float64 { return float64(a.Load()) }, nil
+	case atomicInt64Type:
+		a := fv.Addr().Interface().(*atomic.Int64)
+		return func() float64 { return float64(a.Load()) }, nil
+	case atomicUint32Type:
+		a := fv.Addr().Interface().(*atomic.Uint32)
+		return func() float64 { return float64(a.Load()) }, nil
+	case atomicUint64Type:
+		a := fv.Addr().Interface().(*atomic.Uint64)
+		return func() float64 { return float64(a.Load()) }, nil
+	}
+
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func() float64 { return float64(fv.Int()) }, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func() float64 { return float64(fv.Uint()) }, nil
+	case reflect.Float32, reflect.Float64:
+		return fv.Float, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", fv.Type())
+}
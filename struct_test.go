@@ -0,0 +1,88 @@
+package newrelic
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testStats struct {
+	Requests atomic.Int64  `newrelic:"Requests/Total,requests,delta"`
+	Active   atomic.Int32  `newrelic:"Requests/Active,requests"`
+	Bytes    atomic.Uint64 `newrelic:"Bytes/Sent,bytes,delta"`
+	Hits     atomic.Uint32 `newrelic:"Cache/Hits,hits"`
+	Depth    int           `newrelic:"Queue/Depth,messages"`
+	Ratio    float64       `newrelic:"Cache/Ratio"`
+	Workers  uint8         `newrelic:"Workers,workers,gauge"`
+	Ignored  int           `newrelic:"-"`
+	Untagged int
+}
+
+func Test_RegisterStruct(t *testing.T) {
+	stats := &testStats{Depth: 3, Ratio: 0.5, Workers: 4}
+	stats.Requests.Store(10)
+	stats.Active.Store(2)
+	stats.Bytes.Store(100)
+	stats.Hits.Store(7)
+
+	p := &Plugin{Name: "foo", GUID: "com.example.foo"}
+	assert.Nil(t, RegisterStruct(p, stats))
+	assert.Equal(t, 7, len(p.metrics))
+
+	snapshot, err := p.generatePluginSnapshot(time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"Component/Requests/Active[requests]": 2.0,
+		"Component/Cache/Hits[hits]":          7.0,
+		"Component/Queue/Depth[messages]":     3.0,
+		"Component/Cache/Ratio[value]":        0.5,
+		"Component/Workers[workers]":          4.0,
+	}, snapshot.Metrics)
+	p.clearState()
+
+	stats.Requests.Add(5)
+	stats.Bytes.Add(50)
+	stats.Depth = 8
+	snapshot, err = p.generatePluginSnapshot(time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 5.0, snapshot.Metrics["Component/Requests/Total[requests]"])
+	assert.Equal(t, 50.0, snapshot.Metrics["Component/Bytes/Sent[bytes]"])
+	assert.Equal(t, 8.0, snapshot.Metrics["Component/Queue/Depth[messages]"])
+}
+
+func Test_RegisterStruct_rate(t *testing.T) {
+	var stats struct {
+		Requests atomic.Int64 `newrelic:"Requests/Rate,requests/second,rate"`
+	}
+	p := &Plugin{Name: "foo", GUID: "com.example.foo"}
+	assert.Nil(t, RegisterStruct(p, &stats))
+	_, isRate := p.metrics["Component/Requests/Rate[requests/second]"].metric.(*deltaMetric)
+	assert.True(t, isRate)
+}
+
+func Test_RegisterStruct_errors(t *testing.T) {
+	p := &Plugin{Name: "foo", GUID: "com.example.foo"}
+
+	assert.NotNil(t, RegisterStruct(p, testStats{}))
+	assert.NotNil(t, RegisterStruct(p, (*testStats)(nil)))
+	var i int
+	assert.NotNil(t, RegisterStruct(p, &i))
+
+	var bad struct {
+		Good     int    `newrelic:"Good,things"`
+		Name     string `newrelic:"Name,things"`
+		unexp    int    `newrelic:"Unexported,things"`
+		Kind     int    `newrelic:"Kind,things,sideways"`
+		Invalid  int    `newrelic:"Bad[1],things"`
+		TooMany  int    `newrelic:"Many,things,gauge,extra"`
+		Conflict int    `newrelic:"Good,things"`
+	}
+	bad.unexp = 1
+
+	err := RegisterStruct(p, &bad)
+	assert.NotNil(t, err)
+	assert.Equal(t, 6, len(err.(CompositeError)))
+	assert.Equal(t, 1, len(p.metrics))
+}
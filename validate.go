@@ -0,0 +1,229 @@
+package newrelic
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/neocortical/newrelic/model"
+)
+
+const (
+	// MaxMetricKeyLength is the longest metric key accepted, including the
+	// Component/ prefix and the bracketed units
+	MaxMetricKeyLength = 255
+	// MaxPluginNameLength is the longest plugin (component) name accepted
+	MaxPluginNameLength = 128
+	// MaxGUIDLength is the longest plugin GUID accepted
+	MaxGUIDLength = 128
+
+	// defaultUnits replaces empty units when sanitizing
+	defaultUnits = "value"
+
+	// maxSanitizedUnitsLength limits units when sanitizing, so that a long
+	// unit can't leave no room for the name
+	maxSanitizedUnitsLength = 64
+)
+
+// guidPattern matches reverse-domain GUIDs such as com.example.newrelic.myplugin
+var guidPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)+$`)
+
+// ValidateMetric checks that a metric's name and units produce a well-formed
+// metric key
+func ValidateMetric(m Metric) error {
+	name, units := m.Name(), m.Units()
+
+	if name == "" {
+		return fmt.Errorf("metric name is empty")
+	}
+	if strings.ContainsAny(name, "[]") {
+		return fmt.Errorf("metric name %q contains '[' or ']'", name)
+	}
+	if strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") {
+		return fmt.Errorf("metric name %q has a leading or trailing '/'", name)
+	}
+	if strings.Contains(name, "//") {
+		return fmt.Errorf("metric name %q has an empty segment", name)
+	}
+	if !printable(name) {
+		return fmt.Errorf("metric name %q contains invalid characters", name)
+	}
+
+	if units == "" {
+		return fmt.Errorf("metric %s has no units", name)
+	}
+	if strings.ContainsAny(units, "[]") {
+		return fmt.Errorf("metric %s units %q contain '[' or ']'", name, units)
+	}
+	if !printable(units) {
+		return fmt.Errorf("metric %s units %q contain invalid characters", name, units)
+	}
+
+	if key := generateMetricKey(m); len(key) > MaxMetricKeyLength {
+		return fmt.Errorf("metric key %s is longer than %d characters", key, MaxMetricKeyLength)
+	}
+	return nil
+}
+
+// ValidatePlugin checks a plugin's name and GUID
+func ValidatePlugin(p *Plugin) error {
+	if p.Name == "" {
+		return fmt.Errorf("plugin name is empty")
+	}
+	if len(p.Name) > MaxPluginNameLength {
+		return fmt.Errorf("plugin name %q is longer than %d characters", p.Name, MaxPluginNameLength)
+	}
+	if !printable(p.Name) {
+		return fmt.Errorf("plugin name %q contains invalid characters", p.Name)
+	}
+
+	if len(p.GUID) > MaxGUIDLength {
+		return fmt.Errorf("plugin %s GUID %q is longer than %d characters", p.Name, p.GUID, MaxGUIDLength)
+	}
+	if !guidPattern.MatchString(p.GUID) {
+		return fmt.Errorf("plugin %s GUID %q is not in reverse domain format (e.g. com.example.myplugin)", p.Name, p.GUID)
+	}
+	return nil
+}
+
+// ValidateRequest checks a complete request as it would be posted: the agent
+// info, every component's name, GUID and duration, and every metric key and
+// value. All problems found are returned together.
+func ValidateRequest(request model.Request) error {
+	var err CompositeError
+	if request.Agent.Host == "" {
+		err = err.Accumulate(fmt.Errorf("agent host is empty"))
+	}
+	if request.Agent.Version == "" {
+		err = err.Accumulate(fmt.Errorf("agent version is empty"))
+	}
+
+	for _, ps := range request.Plugins {
+		err = err.Accumulate(ValidatePlugin(&Plugin{Name: ps.Name, GUID: ps.GUID}))
+		if ps.DurationSec <= 0 {
+			err = err.Accumulate(fmt.Errorf("plugin %s has invalid duration %d", ps.Name, ps.DurationSec))
+		}
+		for key, value := range ps.Metrics {
+			err = err.Accumulate(validateMetricKey(key))
+			err = err.Accumulate(validateMetricValue(key, value))
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func validateMetricKey(key string) error {
+	if len(key) > MaxMetricKeyLength {
+		return fmt.Errorf("metric key %s is longer than %d characters", key, MaxMetricKeyLength)
+	}
+	if !strings.HasPrefix(key, "Component/") {
+		return fmt.Errorf("metric key %s does not start with Component/", key)
+	}
+	name, units := splitMetricKey(key)
+	if !strings.HasSuffix(key, "]") || units == "" {
+		return fmt.Errorf("metric key %s has no units", key)
+	}
+	return ValidateMetric(NewMetric(name, units, nil))
+}
+
+func validateMetricValue(key string, value interface{}) error {
+	switch v := value.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("metric %s has non-finite value %v", key, v)
+		}
+	case model.MetricValue:
+		if v.Count <= 0 {
+			return fmt.Errorf("metric %s has non-positive count %d", key, v.Count)
+		}
+		for _, f := range []float64{v.Min, v.Max, v.Total, v.SumOfSquares} {
+			if math.IsNaN(f) || math.IsInf(f, 0) {
+				return fmt.Errorf("metric %s has non-finite value %v", key, v)
+			}
+		}
+	default:
+		return fmt.Errorf("metric %s has unexpected value %v", key, value)
+	}
+	return nil
+}
+
+// SanitizeMetricName repairs a metric name so that it passes validation:
+// brackets become parentheses, invalid characters and empty segments are
+// dropped and leading or trailing slashes are trimmed. The result is empty
+// if nothing usable remains.
+func SanitizeMetricName(name string) string {
+	name = strings.Map(sanitizeRune, name)
+
+	segments := strings.Split(name, "/")
+	kept := segments[:0]
+	for _, s := range segments {
+		if s != "" {
+			kept = append(kept, s)
+		}
+	}
+	return strings.Join(kept, "/")
+}
+
+// SanitizeUnits repairs metric units so that they pass validation
+func SanitizeUnits(units string) string {
+	units = strings.Map(sanitizeRune, units)
+	if units == "" {
+		return defaultUnits
+	}
+	return units
+}
+
+// sanitizeMetricKey sanitizes a name and units and truncates them so the
+// resulting key fits within MaxMetricKeyLength
+func sanitizeMetricKey(name, units string) string {
+	name, units = SanitizeMetricName(name), SanitizeUnits(units)
+	units = truncate(units, maxSanitizedUnitsLength)
+
+	max := MaxMetricKeyLength - len(metricKey("", units))
+	if len(name) > max {
+		name = strings.TrimRight(truncate(name, max), "/")
+	}
+	return metricKey(name, units)
+}
+
+// truncate shortens s to at most max bytes without splitting a rune
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	s = s[:max]
+	for !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+func sanitizeRune(r rune) rune {
+	switch {
+	case r == '[':
+		return '('
+	case r == ']':
+		return ')'
+	case r == utf8.RuneError, !unicode.IsPrint(r):
+		return -1
+	}
+	return r
+}
+
+func printable(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package newrelic
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/neocortical/newrelic/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ValidateMetric(t *testing.T) {
+	poll := func() (float64, error) { return 1, nil }
+
+	valid := []Metric{
+		NewMetric("foo", "bars", poll),
+		NewMetric("Queue/Depth", "messages/sec", poll),
+		NewMetric("Üñíçødé names", "µs", poll),
+	}
+	for _, m := range valid {
+		assert.Nil(t, ValidateMetric(m), m.Name())
+	}
+
+	invalid := []Metric{
+		NewMetric("", "bars", poll),
+		NewMetric("foo[1]", "bars", poll),
+		NewMetric("/foo", "bars", poll),
+		NewMetric("foo/", "bars", poll),
+		NewMetric("foo//bar", "bars", poll),
+		NewMetric("foo\nbar", "bars", poll),
+		NewMetric("foo\xff", "bars", poll),
+		NewMetric("foo", "", poll),
+		NewMetric("foo", "[bars]", poll),
+		NewMetric("foo", "bars\t", poll),
+		NewMetric(strings.Repeat("a", MaxMetricKeyLength), "bars", poll),
+	}
+	for _, m := range invalid {
+		assert.NotNil(t, ValidateMetric(m), m.Name())
+	}
+}
+
+func Test_ValidatePlugin(t *testing.T) {
+	assert.Nil(t, ValidatePlugin(&Plugin{Name: "My Plugin", GUID: "com.example.newrelic.my_plugin"}))
+	assert.Nil(t, ValidatePlugin(&Plugin{Name: "My Plugin", GUID: "com.Example.plugin-1"}))
+
+	invalid := []*Plugin{
+		{GUID: "com.example.foo"},
+		{Name: strings.Repeat("a", MaxPluginNameLength+1), GUID: "com.example.foo"},
+		{Name: "foo\x00", GUID: "com.example.foo"},
+		{Name: "foo"},
+		{Name: "foo", GUID: "foo"},
+		{Name: "foo", GUID: "com..example"},
+		{Name: "foo", GUID: ".com.example"},
+		{Name: "foo", GUID: "com.example/foo"},
+		{Name: "foo", GUID: "com.example." + strings.Repeat("a", MaxGUIDLength)},
+	}
+	for _, p := range invalid {
+		assert.NotNil(t, ValidatePlugin(p), p.Name+" "+p.GUID)
+	}
+}
+
+func Test_ValidateRequest(t *testing.T) {
+	request := model.Request{
+		Agent: model.Agent{Host: "10.0.0.1", Version: "1.0.0"},
+		Plugins: []model.PluginSnapshot{{
+			Name:        "MyPlugin",
+			GUID:        "com.example.myplugin",
+			DurationSec: 60,
+			Metrics: map[string]interface{}{
+				"Component/foo[bars]": 1.0,
+				"Component/baz[bars]": model.MetricValue{Min: 1, Max: 2, Total: 3, Count: 2, SumOfSquares: 5},
+			},
+		}},
+	}
+	assert.Nil(t, ValidateRequest(request))
+
+	request.Agent.Host = ""
+	request.Plugins[0].DurationSec = 0
+	request.Plugins[0].Metrics = map[string]interface{}{
+		"foo[bars]":              1.0,
+		"Component/foo":          1.0,
+		"Component/[bars]":       1.0,
+		"Component/nan[bars]":    math.NaN(),
+		"Component/empty[bars]":  model.MetricValue{},
+		"Component/string[bars]": "1",
+		"Component/" + strings.Repeat("a", 250) + "[bars]": 1.0,
+	}
+	err := ValidateRequest(request)
+	assert.NotNil(t, err)
+	assert.Equal(t, 9, len(err.(CompositeError)))
+}
+
+func Test_SanitizeMetricName(t *testing.T) {
+	assert.Equal(t, "foo", SanitizeMetricName("foo"))
+	assert.Equal(t, "foo(1)/bar", SanitizeMetricName("/foo[1]//bar/"))
+	assert.Equal(t, "foobar", SanitizeMetricName("foo\nbar\xff"))
+	assert.Equal(t, "", SanitizeMetricName("//"))
+
+	assert.Equal(t, "bars", SanitizeUnits("bars"))
+	assert.Equal(t, "(bars)", SanitizeUnits("[bars]"))
+	assert.Equal(t, "value", SanitizeUnits(""))
+}
+
+func Test_sanitizeMetricKey_truncates(t *testing.T) {
+	key := sanitizeMetricKey(strings.Repeat("a", 300), "bars")
+	assert.Equal(t, MaxMetricKeyLength, len(key))
+	assert.True(t, strings.HasSuffix(key, "a[bars]"))
+
+	key = sanitizeMetricKey(strings.Repeat("é", 200), "bars")
+	assert.True(t, len(key) <= MaxMetricKeyLength)
+	assert.True(t, strings.HasSuffix(key, "é[bars]"))
+
+	key = sanitizeMetricKey(strings.Repeat("a", 238)+"/bbbbbb", "bars")
+	assert.Equal(t, "Component/"+strings.Repeat("a", 238)+"[bars]", key)
+}
+
+func Test_sanitizeMetricKey_longUnits(t *testing.T) {
+	key := sanitizeMetricKey("foo", strings.Repeat("u", 250))
+	assert.Equal(t, "Component/foo["+strings.Repeat("u", maxSanitizedUnitsLength)+"]", key)
+
+	key = sanitizeMetricKey(strings.Repeat("a", 300), strings.Repeat("é", 200))
+	assert.True(t, len(key) <= MaxMetricKeyLength)
+	assert.True(t, strings.HasPrefix(key, "Component/a"))
+
+	p := &Plugin{Name: "foo", GUID: "com.example.foo", SanitizeNames: true}
+	assert.Nil(t, p.AddMetric(NewMetric("foo", strings.Repeat("u", 250), func() (float64, error) { return 1, nil })))
+}